@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Go runs fn in a goroutine that the CLI waits for before it exits so
+// that background work started by a command, e.g. flushing telemetry,
+// can complete. The CLI waits after the command and its Hooks.After
+// have returned and prints the errors fn returns with the full name
+// of the command. If the command succeeded, the CLI then exits with
+// StatusError if any fn failed and with the command's status otherwise.
+//
+// fn should not use the context passed to the command as it may be
+// cancelled once the command returns, e.g. when Config.Timeout is set.
+//
+// The passed context must be derived from the context
+// passed to Run.
+func Go(ctx context.Context, fn func() error) {
+	g := ctx.Value(goGroupKey{}).(*goGroup)
+	fullname := FullName(ctx)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		err := fn()
+		if err != nil {
+			g.mu.Lock()
+			g.errs = append(g.errs, fmt.Errorf("%v: %v", fullname, err))
+			g.mu.Unlock()
+		}
+	}()
+}
+
+// goGroup holds the goroutines started with Go.
+type goGroup struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+// wait waits for the goroutines, prints their errors to stderr and
+// returns the status the CLI should exit with given the command's status.
+func (g *goGroup) wait(stderr io.Writer, status int) int {
+	g.wg.Wait()
+	for _, err := range g.errs {
+		fmt.Fprintln(stderr, err)
+	}
+	if status == StatusOK && len(g.errs) > 0 {
+		return StatusError
+	}
+	return status
+}
+
+type goGroupKey struct{}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGo(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		err    error
+		exp    int
+		stderr string
+	}{
+		{name: "ok"},
+		{name: "error", err: errors.New("failed to flush"), exp: 1, stderr: "root bg: failed to flush\n"},
+		{name: "statusKept", status: 3, err: errors.New("failed to flush"), exp: 3, stderr: "root bg: failed to flush\n"},
+	}
+
+	for _, tc := range testCases {
+		var done bool
+		root := &testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testLeaf{
+					name: "bg",
+					run: func(ctx context.Context, args []string) int {
+						Go(ctx, func() error {
+							time.Sleep(10 * time.Millisecond)
+							done = true
+							return tc.err
+						})
+						return tc.status
+					},
+				},
+			},
+		}
+
+		status, _, stderr := runTest(t, root, "bg")
+		if !done {
+			t.Errorf("%v: exited before the goroutine finished", tc.name)
+		}
+		if status != tc.exp || stderr != tc.stderr {
+			t.Errorf("%v: unexpected status %v and stderr %q", tc.name, status, stderr)
+		}
+	}
+}
@@ -5,20 +5,306 @@ package cli
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"text/tabwriter"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// The statuses the CLI exits with. Scripts can rely on them to
+// tell usage errors apart from failures of the command itself.
+//
+// Commands may return any other status from Run, e.g. ExitCode
+// propagates the status of a child process.
+const (
+	// StatusOK is returned when the command succeeds,
+	// including when help or the version is requested.
+	StatusOK = 0
+	// StatusError is returned when the command fails.
+	StatusError = 1
+	// StatusUsage is returned when the command is invoked incorrectly,
+	// e.g. with an unknown flag or subcommand, and by Helpf.
+	StatusUsage = 2
+	// StatusPanic is returned when RecoverPanics recovers a panic
+	// like EX_SOFTWARE from sysexits.h.
+	StatusPanic = 70
+	// StatusTimeout is returned when Timeout passes
+	// like with timeout(1).
+	StatusTimeout = 124
 )
 
 // Version represents the version of the CLI.
 // You can use go generate or go build -X to populate this.
 var Version = "<dev>"
 
+// Config holds the settings of a CLI. NewConfig returns one with the
+// defaults documented on each field, which is what Run and RunStatus
+// use. The methods of Config with the same names run the CLI with its
+// settings instead.
+//
+// A Config must not be modified while a CLI runs with it but separate
+// Configs may be used concurrently, e.g. in parallel tests.
+type Config struct {
+	// Version is the version of the CLI printed by -version and in help.
+	// It defaults to the package level Version so that CLIs sharing the
+	// package in one repository can each have their own.
+	Version string
+
+	// VersionFunc, if set, is called to produce the version printed
+	// by -version and in help instead of using Version.
+	// It is useful for including build metadata such as the commit.
+	VersionFunc func() string
+
+	// ShowVersionInHelp controls whether help includes the version.
+	// It is enabled by NewConfig. Disable it to keep help minimal,
+	// e.g. when it is piped into other tools.
+	ShowVersionInHelp bool
+
+	// HelpWidth is the width descriptions in help are wrapped to.
+	// When zero, the width of the terminal Stderr refers to is used
+	// or 80 if it is not a terminal.
+	HelpWidth int
+
+	// HelpPadding is the number of spaces between the columns of the
+	// listings in help, e.g. of subcommands. When zero, it is 4 or 2 if
+	// help is narrower than 80 columns.
+	HelpPadding int
+
+	// Color controls whether help is colorized with ANSI escape codes.
+	// It defaults to ColorAuto.
+	Color ColorMode
+
+	// UsePager pipes help through the pager in the PAGER environment
+	// variable, or less if it is unset, when help is written to a terminal
+	// that it does not fit on. Help is written directly if the pager
+	// cannot be started.
+	UsePager bool
+
+	// Topics are documentation pages keyed by name that explain concepts
+	// spanning several commands, e.g. the format of a config file.
+	// They are listed in the help of the root command along with the first
+	// line of their content and printed in full by "examplecli help <topic>".
+	// Topics are not commands and cannot be run otherwise.
+	Topics map[string]string
+
+	// HelpToStdout writes help requested with -help to Stdout instead of
+	// Stderr so that it can be piped, e.g. into grep. Help printed because
+	// the command was invoked incorrectly is still written to Stderr.
+	HelpToStdout bool
+
+	// HelpSearch makes "help search <term>" on the root command print the
+	// commands that Search finds for term.
+	HelpSearch bool
+
+	// InterspersedFlags allows flags to follow arguments for leaves,
+	// e.g. "examplecli ls /tmp -l". By default, flag parsing stops at
+	// the first argument like with the flag package.
+	// Everything after -- is still treated as arguments.
+	InterspersedFlags bool
+
+	// AllowFlagPrefix allows flags to be passed with an unambiguous prefix
+	// of their name, e.g. "-verb" for "-verbose". Exact matches always take
+	// precedence and an ambiguous prefix is an error listing the flags it
+	// could be. Hidden flags must be passed by their full name.
+	AllowFlagPrefix bool
+
+	// RecoverPanics makes the CLI recover panics in Leaf.Run, print them
+	// with the name of the command and exit with StatusPanic. Unlike the
+	// Go runtime, the stack trace is not printed.
+	// Leave it disabled to get the stack trace when debugging.
+	RecoverPanics bool
+
+	// AllowPrefixMatch allows subcommands to be invoked with an unambiguous
+	// prefix of their name or alias, e.g. "examplecli l" for "examplecli ls".
+	// Exact matches always take precedence. Hidden commands must be
+	// invoked by their full name.
+	AllowPrefixMatch bool
+
+	// Timeout, when non-zero, is the deadline for Leaf.Run. The context
+	// passed to Run is cancelled once it passes and the CLI exits with
+	// status 124 like timeout(1) after Run returns.
+	// Commands must still respect ctx.Done() for it to have any effect.
+	Timeout time.Duration
+
+	// CompletionFlag registers a -completion flag on the root command that
+	// prints the completion script for the shell passed as its value,
+	// bash, zsh or fish, and exits. When passed without a value, the shell
+	// is taken from $SHELL, e.g. "examplecli -completion".
+	CompletionFlag bool
+
+	// DefaultCommandEnv is the name of an environment variable, e.g.
+	// "EXAMPLECLI_DEFAULT_CMD", that names the subcommand of the root to
+	// run when it is invoked without one. It takes precedence over
+	// Defaulter so that users can pick their own default.
+	DefaultCommandEnv string
+
+	// DryRunFlag registers a persistent -dry-run flag on the root command
+	// that every command accepts. Commands check it with DryRun.
+	DryRunFlag bool
+
+	// TraceIDFlag registers a persistent -trace-id flag on the root command
+	// to set the ID TraceID returns, e.g. to correlate the requests of an
+	// invocation with those of the program that ran it. The ID is also
+	// included in the prefix of Logger.
+	TraceIDFlag bool
+
+	// ProgramName, when set, is used as the name of the root command in
+	// help instead of its Name, e.g. when the binary is installed under
+	// a different name or invoked through a symlink.
+	ProgramName string
+
+	// Translate, if set, is called to translate the strings the package
+	// generates for help and errors, e.g. "Usage:" or "unknown subcommand: %q",
+	// so that they can be localized. Format strings are translated before
+	// they are formatted. Strings from commands, e.g. their descriptions,
+	// are not translated.
+	Translate func(string) string
+
+	// ExternalSubcommands makes branches run an executable in $PATH named
+	// after the branch and the subcommand joined with -, e.g. examplecli-foo
+	// for "examplecli foo", when the subcommand is not one of theirs like
+	// git does. The executable is passed the remaining arguments and its
+	// exit status becomes the CLI's.
+	ExternalSubcommands bool
+
+	// Middleware wraps every invocation of a leaf, e.g. to record metrics,
+	// check authorization or rewrite the arguments. The first middleware
+	// is the outermost. Each must call next to run the leaf and may return
+	// a status without calling it to stop the leaf from running.
+	// FullName and the other context functions work on the passed context.
+	Middleware []func(next RunFunc) RunFunc
+
+	// FlagErrorHandling controls what happens after an error parsing
+	// flags is reported. With flag.ContinueOnError, the default, the CLI
+	// exits with StatusUsage. With flag.ExitOnError, the process exits with
+	// it immediately like with the flag package and with flag.PanicOnError
+	// the error is panicked.
+	FlagErrorHandling flag.ErrorHandling
+
+	// SilenceFlagErrors stops the CLI from printing errors parsing flags
+	// and the usage that follows them, e.g. when they are reported by
+	// other means.
+	SilenceFlagErrors bool
+
+	// ArgFiles makes arguments of the form @file be replaced with the
+	// arguments in file before the CLI runs, e.g. to get around limits on
+	// the length of the command line. The arguments in the file are split
+	// on whitespace and quotes like a shell does and may refer to other
+	// files. @@ escapes a literal @ and arguments after -- are left as is.
+	//
+	// Arguments are expanded before flags are parsed, so flag values are
+	// expanded too unless passed with =. E.g. with FileOrStringVar,
+	// -token=@file reads the token from file while -token @file is replaced
+	// with the arguments in file, and a literal @ has to be escaped twice
+	// as in -token @@@x.
+	ArgFiles bool
+
+	// LogLevel is the minimum slog.Level of the records logged by the
+	// default logger SlogLogger returns. It is an int so that Config
+	// does not require log/slog. It defaults to slog.LevelInfo.
+	LogLevel int
+
+	// Stdin, Stdout and Stderr are the streams the functions with the
+	// same names return by default.
+	// The CLI writes its own output to Stdout and Stderr. Help is written
+	// to Stderr, unless HelpToStdout is set, and the version to Stdout.
+	// They default to os.Stdin, os.Stdout and os.Stderr.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewConfig returns a Config with the default settings.
+func NewConfig() *Config {
+	return &Config{
+		ShowVersionInHelp: true,
+	}
+}
+
+// WithVersion returns a VersionFunc for a version built from
+// the version, commit and date of the build, e.g.
+// "v1.2.3 (abc123, 2024-01-01)". Empty fields are omitted and
+// the package level Version is used if version is empty.
+//
+//	c.VersionFunc = cli.WithVersion(version, commit, date)
+func WithVersion(version, commit, date string) func() string {
+	return func() string {
+		v := version
+		if v == "" {
+			v = Version
+		}
+
+		var meta []string
+		for _, s := range []string{commit, date} {
+			if s != "" {
+				meta = append(meta, s)
+			}
+		}
+		if len(meta) > 0 {
+			v += " (" + strings.Join(meta, ", ") + ")"
+		}
+		return v
+	}
+}
+
+// config returns the Config the CLI runs with.
+//
+// The passed context must be derived from the context
+// passed to Run.
+func config(ctx context.Context) *Config {
+	return ctx.Value(configKey{}).(*Config)
+}
+
+func (c *Config) stdin() io.Reader {
+	if c.Stdin == nil {
+		return os.Stdin
+	}
+	return c.Stdin
+}
+
+func (c *Config) stdout() io.Writer {
+	if c.Stdout == nil {
+		return os.Stdout
+	}
+	return c.Stdout
+}
+
+func (c *Config) stderr() io.Writer {
+	if c.Stderr == nil {
+		return os.Stderr
+	}
+	return c.Stderr
+}
+
+// tr translates s with Translate.
+func (c *Config) tr(s string) string {
+	if c.Translate == nil {
+		return s
+	}
+	return c.Translate(s)
+}
+
+// RunFunc is the signature of Leaf.Run.
+type RunFunc func(ctx context.Context, args []string) int
+
 // Command represents a CLI command.
-// Any type that implements Command must implement either Leaf or Branch.
+// Any type that implements Command must implement one of Leaf, LeafE or Branch.
 type Command interface {
 	// Name returns the name a user will use to refer to the command.
 	Name() string
@@ -30,6 +316,9 @@ type Command interface {
 	Desc() string
 
 	// Flags should register the command's flags on the passed flagset.
+	// It is called at most once per command each time the CLI is run
+	// but may be called again in later runs, e.g. in tests, so it should
+	// reset any state it relies on rather than accumulate it.
 	Flags(f *flag.FlagSet)
 }
 
@@ -41,14 +330,52 @@ type Leaf interface {
 	// A flags field will be added automatically to the usage line when
 	// at least one flag is defined so it should not include any flag fields.
 	// E.g. if the command is ls, it might be "<dir>".
+	// Arguments after -- are passed to Run verbatim even if they
+	// look like flags, e.g. to forward them to another program.
 	Usage() string
 
 	// Run is called when the command is invoked.
 	// The returned integer will become the status code for the CLI.
+	// Any contexts created by Run should be derived from ctx so that
+	// they are cancelled along with it. When the CLI is started with
+	// RunSignal, ctx is cancelled once the process receives SIGINT
+	// or SIGTERM.
 	Run(ctx context.Context, args []string) int
 }
 
+// LeafE is like Leaf but for commands that return an error instead of
+// a status code. It is an alternative to Leaf; a command implements
+// one or the other. Its number of arguments is validated like ArgCount
+// if it has an NArgs method.
+type LeafE interface {
+	Command
+
+	// Usage is like Leaf.Usage.
+	Usage() string
+
+	// RunE is called when the command is invoked.
+	// If it returns an error, the error is printed to stderr prefixed
+	// with the command's full name and the status code for the CLI is 1.
+	// If the error, or any error it wraps, has an ExitCode() int method,
+	// the status code is its result instead.
+	RunE(ctx context.Context, args []string) error
+}
+
+// ArgCount is implemented by leaves that accept a bounded number
+// of arguments. The number of arguments is validated before Run
+// is called.
+type ArgCount interface {
+	Leaf
+
+	// NArgs returns the minimum and maximum number of arguments.
+	// A negative maximum means there is no maximum.
+	NArgs() (min, max int)
+}
+
 // Branch represents a command that has subcommands.
+// A branch may also implement Leaf or LeafE to be run itself when it
+// is invoked without a subcommand or with an argument that is not one
+// of its subcommands, e.g. like git stash.
 type Branch interface {
 	Command
 
@@ -56,156 +383,1821 @@ type Branch interface {
 	Subcommands() []Command
 }
 
-// Helpf prints the msg followed by the help for the
-// current command.
+// Persistent is implemented by branches with flags that are
+// inherited by all of their descendants.
+type Persistent interface {
+	Branch
+
+	// PersistentFlags should register the flags on the passed flagset
+	// that the command and all of its descendants accept.
+	// They are registered before the flags from Flags.
+	// Like Flags, it is called at most once per run.
+	PersistentFlags(f *flag.FlagSet)
+}
+
+// Hideable is implemented by commands that can be hidden from help.
+// Hidden commands can still be invoked.
+type Hideable interface {
+	Command
+
+	// Hidden reports whether the command should be left out of the
+	// help of its parent, completions and other generated documentation.
+	Hidden() bool
+}
+
+// Deprecatable is implemented by commands that can be deprecated.
+// Deprecated commands still run but print a warning first.
+// The warning is not printed if help is requested.
+type Deprecatable interface {
+	Command
+
+	// Deprecated returns why the command is deprecated and what to use
+	// instead or "" if it is not deprecated.
+	// E.g. "use newcmd instead".
+	Deprecated() string
+}
+
+// Deprecation describes why a command is deprecated
+// and when it will be removed.
+type Deprecation struct {
+	// Message is why the command is deprecated and what to use
+	// instead, e.g. "use newcmd instead".
+	Message string
+	// RemovedIn is the version the command will be removed in,
+	// e.g. "v2.0".
+	RemovedIn string
+}
+
+// DeprecatableInfo is like Deprecatable but for commands that
+// also say when they will be removed. It takes precedence over
+// Deprecatable. The command is deprecated if the returned
+// Deprecation is not empty.
+type DeprecatableInfo interface {
+	Command
+
+	// DeprecatedInfo returns the deprecation of the command.
+	DeprecatedInfo() Deprecation
+}
+
+// Grouped is implemented by commands that are listed under a heading
+// in the help of their parent along with the other commands in their
+// group.
+type Grouped interface {
+	Command
+
+	// Group returns the name of the command's group or "" for the
+	// default group. E.g. "Management Commands".
+	Group() string
+}
+
+// Exampled is implemented by commands with examples of their use
+// that are listed in their help.
+type Exampled interface {
+	Command
+
+	// Examples returns the examples, one invocation per entry.
+	// E.g. if the command is ls, it might return "examplecli ls -l /tmp".
+	Examples() []string
+}
+
+// ArgDef describes a positional argument of a command.
+type ArgDef struct {
+	// Name is the name of the argument as shown in help, e.g. "<src>"
+	// or "[dest]" if it is optional.
+	Name string
+	// Desc describes the argument.
+	Desc string
+}
+
+// ArgDescribed is implemented by leaves that describe each of their
+// positional arguments. They are listed in the help of the command.
+// If the Usage of the leaf is empty, it is built from the names
+// of the arguments.
+type ArgDescribed interface {
+	Command
+
+	// PositionalArgs returns the positional arguments in order.
+	PositionalArgs() []ArgDef
+}
+
+// Defaulter is implemented by branches that run one of their
+// subcommands when invoked without one.
+type Defaulter interface {
+	Branch
+
+	// Default returns the name of the subcommand to run when
+	// no subcommand is given.
+	Default() string
+}
+
+// Hooks is implemented by commands that need to run code before
+// and after their subcommands. It is useful for setting up
+// resources that all descendants of a branch use.
+type Hooks interface {
+	Command
+
+	// Before is called once the flags of the command and of the
+	// invoked subcommands are parsed and before the invoked command
+	// runs. It is not called if help, version or completion is requested.
+	// The returned context replaces ctx for the rest of the invocation.
+	// If an error is returned, it is printed and the CLI exits with
+	// status 1 without calling After.
+	Before(ctx context.Context) (context.Context, error)
+
+	// After is called with the status of the invocation once the
+	// invoked command returns.
+	After(ctx context.Context, status int)
+}
+
+// Validator is implemented by commands that check preconditions, e.g.
+// that a required environment variable is set, before they are run.
+// Validate is called for every command from the root down to the
+// invoked command once all of their flags are parsed and before
+// Hooks.Before. It is not called if help, version or completion is
+// requested. If it returns an error, the error is printed and the CLI
+// exits with status 1.
+type Validator interface {
+	Command
+
+	Validate(ctx context.Context) error
+}
+
+// Aliased is implemented by commands that can also be invoked
+// by names other than the one returned by Name.
+type Aliased interface {
+	Command
+
+	// Aliases returns the command's alternative names.
+	// E.g. if the command is ls, it might be []string{"list"}.
+	Aliases() []string
+}
+
+// Helpf prints the msg prefixed with the full name of the current
+// command to Config.Stderr followed by its help and returns StatusUsage.
+// E.g. "examplecli: unknown subcommand: \"foo\"".
 //
 // The passed context must be derived from the context
 // passed to Run.
 func Helpf(ctx context.Context, msg string, v ...interface{}) int {
-	log.Printf(msg+"\n\n", v...)
-	ctx.Value(usageKey{}).(func())()
-	return 1
+	stderr := config(ctx).stderr()
+	fmt.Fprintf(stderr, "%v: %v\n\n", FullName(ctx), fmt.Sprintf(msg, v...))
+	ctx.Value(usageKey{}).(func(io.Writer))(stderr)
+	return StatusUsage
+}
+
+// FullName returns the full name of the invoked command.
+// E.g. if the user ran "examplecli ls", it returns "examplecli ls".
+//
+// The passed context must be derived from the context
+// passed to Run.
+func FullName(ctx context.Context) string {
+	return ctx.Value(fullnameKey{}).(string)
+}
+
+// Logger returns a logger that writes to Stderr(ctx) with the full
+// name of the invoked command as its prefix, e.g. "examplecli ls: ".
+// If Config.TraceIDFlag is set, the prefix includes the trace ID,
+// e.g. "examplecli ls [4d9f...]: ".
+//
+// The passed context must be derived from the context
+// passed to Run.
+func Logger(ctx context.Context) *log.Logger {
+	return log.New(Stderr(ctx), ctx.Value(logPrefixKey{}).(string), 0)
+}
+
+// Stdin returns the input stream the invoked command should read from
+// instead of os.Stdin so that it can be redirected, e.g. in tests.
+// It is Config.Stdin unless replaced with WithStdio.
+//
+// The passed context must be derived from the context
+// passed to Run.
+func Stdin(ctx context.Context) io.Reader {
+	return ctx.Value(stdioKey{}).(stdio).stdin
+}
+
+// Stdout is like Stdin but returns the output stream
+// to write to instead of os.Stdout.
+func Stdout(ctx context.Context) io.Writer {
+	return ctx.Value(stdioKey{}).(stdio).stdout
+}
+
+// Stderr is like Stdin but returns the error stream
+// to write to instead of os.Stderr.
+func Stderr(ctx context.Context) io.Writer {
+	return ctx.Value(stdioKey{}).(stdio).stderr
+}
+
+// WithStdio returns a context derived from ctx in which Stdin, Stdout
+// and Stderr return the passed streams, e.g. for a Hooks.Before or Config.Middleware to redirect
+// the output of the commands it wraps.
+func WithStdio(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) context.Context {
+	return context.WithValue(ctx, stdioKey{}, stdio{stdin: stdin, stdout: stdout, stderr: stderr})
+}
+
+type stdio struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
 }
 
-// Run begins the CLI with cmd.
+// Run begins the CLI with cmd and exits with the returned status.
 func Run(ctx context.Context, cmd Command) {
-	ctx = context.WithValue(ctx, fullnameKey{}, cmd.Name())
-	status := run(ctx, os.Args[1:], cmd)
+	NewConfig().Run(ctx, cmd)
+}
+
+// Run is like the package level Run but with the settings in c.
+func (c *Config) Run(ctx context.Context, cmd Command) {
+	status := c.RunStatus(ctx, cmd, os.Args[1:])
 	os.Exit(status)
 }
 
-func run(ctx context.Context, args []string, cmd Command) int {
-	fullname := ctx.Value(fullnameKey{}).(string)
-	f := initFlagSet(fullname, cmd)
+// Usage returns the usage line of the invoked command without its
+// full name, e.g. "[flags...] <dir>". It reflects the flags registered
+// on the command. Combine it with FullName to print a synopsis:
+//
+//	log.Printf("usage: %v %v", cli.FullName(ctx), cli.Usage(ctx))
+//
+// The passed context must be derived from the context
+// passed to Run.
+func Usage(ctx context.Context) string {
+	return ctx.Value(usageLineKey{}).(string)
+}
 
-	ctx = context.WithValue(ctx, usageKey{}, f.Usage)
+// DryRun reports whether -dry-run was passed. Commands that mutate
+// state should only print what they would do when it is true.
+// It is always false unless Config.DryRunFlag is set.
+//
+// The passed context must be derived from the context
+// passed to Run.
+func DryRun(ctx context.Context) bool {
+	return *ctx.Value(dryRunKey{}).(*bool)
+}
 
-	version := new(bool)
-	if fullname == cmd.Name() {
-		version = f.Bool("version", false, "Print version and exit.")
+// TraceID returns the ID of the invocation to include in logs and
+// requests to remote services so that they can be correlated. It is
+// the value of -trace-id if Config.TraceIDFlag is set and it was passed or
+// a random UUID generated for the invocation otherwise.
+//
+// The passed context must be derived from the context
+// passed to Run.
+func TraceID(ctx context.Context) string {
+	ids := ctx.Value(traceIDKey{}).(traceIDs)
+	if *ids.flag != "" {
+		return *ids.flag
 	}
+	return ids.generated
+}
+
+type traceIDs struct {
+	flag      *string
+	generated string
+}
 
-	err := f.Parse(args)
+// newTraceID returns a random version 4 UUID.
+func newTraceID() string {
+	var b [16]byte
+	_, err := rand.Read(b[:])
 	if err != nil {
-		return 1
+		panicf("failed to generate trace ID: %v", err)
 	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
 
-	if *version {
-		os.Stdout.WriteString(Version + "\n")
-		return 0
-	}
+// FlagSet returns the flagset the invoked command's arguments were
+// parsed with. It contains the flags registered by the command's Flags
+// method along with the inherited persistent flags and the builtin
+// flags. It is useful for checking which flags were explicitly set
+// with Visit.
+//
+// The passed context must be derived from the context
+// passed to Run.
+func FlagSet(ctx context.Context) *flag.FlagSet {
+	return ctx.Value(flagSetKey{}).(*flag.FlagSet)
+}
 
-	switch cmd := cmd.(type) {
-	case Leaf:
-		return cmd.Run(ctx, f.Args())
-	case Branch:
-		if f.NArg() < 1 {
-			return Helpf(ctx, "please provide a subcommand")
-		}
+// RunMultiCall is like Run but for multi-call binaries like busybox.
+// If the base name of os.Args[0] is the name or alias of a subcommand
+// of cmd, that subcommand is run as if it had been passed as the first
+// argument, e.g. a binary symlinked as ls behaves like "mytool ls".
+// Otherwise the subcommand is taken from the arguments as usual.
+func RunMultiCall(ctx context.Context, cmd Branch) {
+	NewConfig().RunMultiCall(ctx, cmd)
+}
+
+// RunMultiCall is like the package level RunMultiCall
+// but with the settings in c.
+func (c *Config) RunMultiCall(ctx context.Context, cmd Branch) {
+	status := c.RunStatus(ctx, cmd, c.multiCallArgs(cmd, os.Args[0], os.Args[1:]))
+	os.Exit(status)
+}
+
+// multiCallArgs returns the arguments to run cmd with when the
+// program was invoked as argv0 with args.
+func (c *Config) multiCallArgs(cmd Branch, argv0 string, args []string) []string {
+	applet := strings.TrimSuffix(filepath.Base(argv0), ".exe")
+	if _, ok := subcommands(c.rootName(cmd), cmd)[applet]; !ok {
+		return args
+	}
+	return append([]string{applet}, args...)
+}
 
-		for _, subcmd := range cmd.Subcommands() {
-			if subcmd.Name() == f.Arg(0) {
-				ctx = context.WithValue(ctx, fullnameKey{}, fullname+" "+subcmd.Name())
-				return run(ctx, f.Args()[1:], subcmd)
+// expandArgFiles replaces the arguments of the form @file in args with
+// the arguments in file. seen are the files being expanded to detect
+// files that include themselves.
+func expandArgFiles(args []string, seen []string) ([]string, error) {
+	var expanded []string
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return append(expanded, args[i:]...), nil
+		case strings.HasPrefix(arg, "@@"):
+			expanded = append(expanded, arg[1:])
+		case strings.HasPrefix(arg, "@") && len(arg) > 1:
+			name := arg[1:]
+			for _, s := range seen {
+				if s == name {
+					return nil, fmt.Errorf("argument file %q includes itself", name)
+				}
+			}
+			b, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read argument file: %v", err)
+			}
+			fileArgs, err := splitWords(string(b))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse argument file %q: %v", name, err)
+			}
+			fileArgs, err = expandArgFiles(fileArgs, append(seen, name))
+			if err != nil {
+				return nil, err
 			}
+			expanded = append(expanded, fileArgs...)
+		default:
+			expanded = append(expanded, arg)
 		}
+	}
+	return expanded, nil
+}
 
-		return Helpf(ctx, "unknown subcommand: %q", f.Arg(0))
-	default:
-		panicf("cmd %T does not implement cli.Leaf or cli.Branch", cmd)
-		panic("unreachable")
+// Root returns a branch with cmds as its subcommands so that a CLI
+// can have multiple top-level commands. It is named after the program,
+// i.e. the base name of os.Args[0], and has no flags or description.
+// E.g. cli.Run(ctx, cli.Root(&lsCmd{}, &cpCmd{})).
+//
+// Root panics if no commands are passed. A CLI with a single command
+// should pass it to Run directly instead.
+func Root(cmds ...Command) Branch {
+	name := filepath.Base(os.Args[0])
+	if len(cmds) == 0 {
+		panicRegistration(name, "no commands passed to Root")
+	}
+	return &rootBranch{
+		name:    name,
+		subcmds: cmds,
 	}
 }
 
-func usage(cmd Command, f *flag.FlagSet) string {
-	usage := ""
+type rootBranch struct {
+	name    string
+	subcmds []Command
+}
 
-	appendUsage := func(str string) {
-		if str == "" {
+func (r *rootBranch) Name() string           { return r.name }
+func (r *rootBranch) Desc() string           { return "" }
+func (r *rootBranch) Flags(f *flag.FlagSet)  {}
+func (r *rootBranch) Subcommands() []Command { return r.subcmds }
+
+// RunSignal is like Run but cancels the context passed to
+// the command when the process receives SIGINT or SIGTERM
+// so that the command can clean up.
+// A second signal exits immediately with status 128 plus
+// the signal number.
+func RunSignal(ctx context.Context, cmd Command) {
+	NewConfig().RunSignal(ctx, cmd)
+}
+
+// RunSignal is like the package level RunSignal
+// but with the settings in c.
+func (c *Config) RunSignal(ctx context.Context, cmd Command) {
+	ctx, cancel := SignalContext(ctx)
+	status := c.RunStatus(ctx, cmd, os.Args[1:])
+	cancel()
+	os.Exit(status)
+}
+
+// SignalContext returns a context derived from ctx that is cancelled
+// when the process receives SIGINT or SIGTERM. A second signal exits
+// immediately with status 128 plus the signal number.
+// Calling the returned cancel function stops the signal handling.
+func SignalContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancelCtx := context.WithCancel(ctx)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	stop := make(chan struct{})
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(stop)
+		})
+		cancelCtx()
+	}
+
+	go func() {
+		defer signal.Stop(sigs)
+
+		select {
+		case <-sigs:
+			cancelCtx()
+		case <-ctx.Done():
 			return
 		}
 
-		if usage != "" {
-			usage += " "
+		select {
+		case sig := <-sigs:
+			status := 1
+			if n, ok := signalNumber(sig); ok {
+				status = 128 + n
+			}
+			os.Exit(status)
+		case <-stop:
 		}
-		usage += str
+	}()
+
+	return ctx, cancel
+}
+
+// ExitCode returns the status code a command should exit with to
+// propagate err from running a child process with os/exec.
+// If err is nil, it returns 0. If err is an *exec.ExitError, it returns
+// the child's exit status or, if the child was killed by a signal,
+// 128 plus the signal number like shells do. Otherwise it returns 1.
+func ExitCode(err error) int {
+	if err == nil {
+		return StatusOK
 	}
 
-	if countFlags(f) > 0 {
-		appendUsage("[flags...]")
+	var eerr *exec.ExitError
+	if !xerrors.As(err, &eerr) {
+		return StatusError
 	}
+	if n, ok := exitSignal(eerr); ok {
+		return 128 + n
+	}
+	if code := eerr.ExitCode(); code >= 0 {
+		return code
+	}
+	return StatusError
+}
 
-	switch cmd := cmd.(type) {
-	case Leaf:
-		appendUsage(cmd.Usage())
-	case Branch:
-		appendUsage("<subcmd>")
+// RunStatus is like Run but parses args instead of os.Args[1:]
+// and returns the status instead of exiting.
+// It is useful for tests and for programs that need to clean up
+// before exiting.
+func RunStatus(ctx context.Context, cmd Command, args []string) int {
+	return NewConfig().RunStatus(ctx, cmd, args)
+}
+
+// RunStatus is like the package level RunStatus
+// but with the settings in c.
+func (c *Config) RunStatus(ctx context.Context, cmd Command, args []string) int {
+	ctx = context.WithValue(ctx, configKey{}, c)
+	if len(args) > 0 && args[0] == completeCmd {
+		return complete(ctx, cmd, args[1:])
+	}
+	if c.HelpSearch && len(args) == 3 && args[0] == "help" && args[1] == "search" {
+		return c.helpSearch(cmd, args[2])
+	}
+	if len(args) == 2 && args[0] == "help" {
+		if content, ok := c.Topics[args[1]]; ok {
+			return c.helpTopic(content)
+		}
 	}
 
-	return usage
+	checkNames(c.rootName(cmd), cmd)
+	ctx = context.WithValue(ctx, fullnameKey{}, c.rootName(cmd))
+	ctx = context.WithValue(ctx, rootKey{}, cmd)
+	if c.ArgFiles {
+		var err error
+		args, err = expandArgFiles(args, nil)
+		if err != nil {
+			fmt.Fprintf(c.stderr(), "%v: %v\n", c.rootName(cmd), err)
+			return StatusError
+		}
+	}
+	persistent, dryRun, traceID := c.rootFlags()
+	ctx = context.WithValue(ctx, dryRunKey{}, dryRun)
+	ctx = context.WithValue(ctx, traceIDKey{}, traceIDs{flag: traceID, generated: newTraceID()})
+	ctx = context.WithValue(ctx, flagCacheKey{}, newFlagCache())
+	if ctx.Value(stdioKey{}) == nil {
+		ctx = WithStdio(ctx, c.stdin(), c.stdout(), c.stderr())
+	}
+	g := &goGroup{}
+	ctx = context.WithValue(ctx, goGroupKey{}, g)
+	return g.wait(c.stderr(), run(ctx, args, cmd, persistent))
 }
 
-func countFlags(f *flag.FlagSet) int {
-	var flagsCount int
-	f.VisitAll(func(_ *flag.Flag) {
-		flagsCount++
+// rootFlags returns the persistent flags the package gives the root
+// command along with the values of -dry-run and -trace-id.
+func (c *Config) rootFlags() ([]*flag.Flag, *bool, *string) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	dryRun := new(bool)
+	if c.DryRunFlag {
+		f.BoolVar(dryRun, "dry-run", false, "Print what would be done without doing it.")
+	}
+	traceID := new(string)
+	if c.TraceIDFlag {
+		f.StringVar(traceID, "trace-id", "", "ID to correlate the invocation with. Generated if empty.")
+	}
+
+	var persistent []*flag.Flag
+	f.VisitAll(func(fl *flag.Flag) {
+		persistent = append(persistent, fl)
 	})
-	return flagsCount
+	return persistent, dryRun, traceID
 }
 
-func initFlagSet(fullname string, cmd Command) *flag.FlagSet {
-	f := flag.NewFlagSet(fullname, flag.ContinueOnError)
-	cmd.Flags(f)
+// run parses args and runs cmd.
+// persistent are the persistent flags inherited from the ancestors of cmd.
+func run(ctx context.Context, args []string, cmd Command, persistent []*flag.Flag) int {
+	c := config(ctx)
+	parent := ctx
+	fullname := FullName(ctx)
+	inherited := persistent
+	cache := ctx.Value(flagCacheKey{}).(*flagCache)
+	root := fullname == c.rootName(ctx.Value(rootKey{}).(Command))
+	f, help, persistent := c.initFlagSet(fullname, cmd, root, persistent, cache)
 
-	f.Usage = func() {
-		var b bytes.Buffer
+	ctx = context.WithValue(ctx, usageKey{}, help)
+	ctx = context.WithValue(ctx, flagSetKey{}, f)
 
-		fmt.Fprintf(&b, "Usage:\n\t%v %v\n", fullname, usage(cmd, f))
+	helpf, versionf := c.builtinFlags(f)
+	var completion *completionValue
+	if c.CompletionFlag && root && f.Lookup("completion") == nil {
+		completion = &completionValue{}
+		f.Var(completion, "completion", c.tr("Print the completion script for the shell passed as -completion=<shell>, or $SHELL if omitted, and exit."))
+	}
+	ctx = context.WithValue(ctx, usageLineKey{}, usage(cmd, f))
 
-		if fullname == cmd.Name() {
-			fmt.Fprintf(&b, "\nVersion: %v\n", Version)
+	_, branch := cmd.(Branch)
+	err := c.parse(f, args, c.InterspersedFlags && isLeaf(cmd) && !branch)
+	c.warnDeprecatedFlags(f)
+	if err == flag.ErrHelp {
+		help(c.helpOutput())
+		return StatusOK
+	}
+	if err == nil {
+		err = checkFlagPairs(f)
+	}
+	if err == nil {
+		err = checkExclusive(f)
+	}
+	if err == nil {
+		err = setFallbacks(f, inherited)
+	}
+	if err != nil {
+		if !c.SilenceFlagErrors {
+			fmt.Fprintf(c.stderr(), "%v: %v\n\n", fullname, err)
+			f.Usage()
 		}
-
-		if cmd.Desc() != "" {
-			fmt.Fprintf(&b, "\n%v\n", cmd.Desc())
+		switch c.FlagErrorHandling {
+		case flag.ExitOnError:
+			os.Exit(StatusUsage)
+		case flag.PanicOnError:
+			panic(err)
 		}
+		return StatusUsage
+	}
 
-		if countFlags(f) > 0 {
-			fmt.Fprintf(&b, "\nFlags:\n")
-			f.SetOutput(&b)
-			f.PrintDefaults()
-		}
+	prefix := fullname + ": "
+	if c.TraceIDFlag {
+		prefix = fmt.Sprintf("%v [%v]: ", fullname, TraceID(ctx))
+	}
+	ctx = context.WithValue(ctx, logPrefixKey{}, prefix)
 
-		if cmd, ok := cmd.(Branch); ok {
-			fmt.Fprintf(&b, "\nSubcommands:\n")
-
-			tw := tabwriter.NewWriter(&b, 0, 0, 4, ' ', 0)
-			for _, subcmd := range cmd.Subcommands() {
-				f2 := flag.NewFlagSet(fullname+" "+subcmd.Name(), flag.ContinueOnError)
-				subcmd.Flags(f2)
-				fmt.Fprintf(tw, "  %v\t%v", subcmd.Name(), usage(subcmd, f2))
-				if subcmd.Desc() != "" {
-					fmt.Fprintf(tw, "\t%v", strings.Split(subcmd.Desc(), "\n")[0])
-				}
-				fmt.Fprintf(tw, "\n")
+	if helpf.json {
+		// HTML escaping is disabled to keep usages like
+		// "<subcmd>" readable for the scripts consuming it.
+		var b bytes.Buffer
+		e := json.NewEncoder(&b)
+		e.SetEscapeHTML(false)
+		e.SetIndent("", "\t")
+		err := e.Encode(c.describe(fullname, cmd, inherited, cache))
+		if err != nil {
+			panicf("failed to marshal description: %v", err)
+		}
+		c.stdout().Write(b.Bytes())
+		return StatusOK
+	}
+	if helpf.help {
+		help(c.helpOutput())
+		return StatusOK
+	}
+
+	if *versionf {
+		io.WriteString(c.stdout(), c.version()+"\n")
+		return StatusOK
+	}
+
+	if completion != nil && completion.set {
+		if f.NArg() > 0 && completion.fromEnv && isCompletionShell(f.Arg(0)) {
+			return Helpf(ctx, c.tr("unexpected argument %q: pass the shell as -completion=%v"), f.Arg(0), f.Arg(0))
+		}
+		if f.NArg() > 0 {
+			return Helpf(ctx, c.tr("unexpected argument %q"), f.Arg(0))
+		}
+		err = c.InstallCompletion(c.stdout(), cmd, completion.shell)
+		if err != nil {
+			fmt.Fprintf(c.stderr(), "%v: %v\n", fullname, err)
+			return StatusError
+		}
+		return StatusOK
+	}
+
+	// The checks and hooks are deferred until the invoked command is
+	// about to run so that they are skipped when a descendant's help,
+	// version or completion is requested.
+	cmdCtx := ctx
+	prepare := func() (context.Context, func(status int), bool) {
+		ctx, after := cmdCtx, func(int) {}
+		if !root {
+			var ok bool
+			ctx, after, ok = parent.Value(prepareKey{}).(prepareFunc)()
+			if !ok {
+				return nil, nil, false
 			}
-			err := tw.Flush()
+			// Reapply the values of cmd onto the context returned
+			// by the hooks of its ancestors.
+			for _, key := range []interface{}{fullnameKey{}, usageKey{}, flagSetKey{}, usageLineKey{}, logPrefixKey{}} {
+				ctx = context.WithValue(ctx, key, cmdCtx.Value(key))
+			}
+		}
+
+		if d := deprecation(cmd); d != (Deprecation{}) {
+			warning := fmt.Sprintf(c.tr("warning: %q is deprecated"), fullname)
+			if d.Message != "" {
+				warning = fmt.Sprintf(c.tr("warning: %q is deprecated: %v"), fullname, d.Message)
+			}
+			if d.RemovedIn != "" {
+				warning += " " + fmt.Sprintf(c.tr("(will be removed in %v)"), d.RemovedIn)
+			}
+			fmt.Fprintln(c.stderr(), warning)
+		}
+
+		if cmd, ok := cmd.(Validator); ok {
+			err := cmd.Validate(ctx)
 			if err != nil {
-				panicf("tabwriter flush error: %v", err)
+				fmt.Fprintf(c.stderr(), "%v: %v\n", fullname, err)
+				after(StatusError)
+				return nil, nil, false
+			}
+		}
+
+		if cmd, ok := cmd.(Hooks); ok {
+			var err error
+			ctx, err = cmd.Before(ctx)
+			if err != nil {
+				fmt.Fprintf(c.stderr(), "%v: %v\n", fullname, err)
+				after(StatusError)
+				return nil, nil, false
+			}
+			ancestors := after
+			hookCtx := ctx
+			after = func(status int) {
+				cmd.After(hookCtx, status)
+				ancestors(status)
+			}
+		}
+		return ctx, after, true
+	}
+	ctx = context.WithValue(ctx, prepareKey{}, prepareFunc(prepare))
+
+	return dispatch(ctx, f, cmd, persistent)
+}
+
+// prepareFunc prints the deprecation warnings of the invoked command
+// and its ancestors and runs their Validate and Hooks.Before methods.
+// It returns the context to run the command with and a function that
+// runs their Hooks.After methods once it returns. If a check or hook
+// fails, it prints the error and reports false.
+type prepareFunc func() (context.Context, func(status int), bool)
+
+// prepared runs fn once the checks and hooks of the invoked
+// command and its ancestors pass.
+func prepared(ctx context.Context, fn func(ctx context.Context) int) int {
+	ctx, after, ok := ctx.Value(prepareKey{}).(prepareFunc)()
+	if !ok {
+		return StatusError
+	}
+	status := fn(ctx)
+	after(status)
+	return status
+}
+
+// dispatch runs cmd with the arguments remaining in f.
+func dispatch(ctx context.Context, f *flag.FlagSet, cmd Command, persistent []*flag.Flag) int {
+	c := config(ctx)
+	fullname := FullName(ctx)
+
+	switch cmd := cmd.(type) {
+	case Branch:
+		subcmds := subcommands(fullname, cmd)
+
+		if f.NArg() < 1 {
+			root := fullname == c.rootName(ctx.Value(rootKey{}).(Command))
+			name, fromEnv := c.defaultSubcommand(cmd, root)
+			if name == "" && isLeaf(cmd) {
+				return dispatchLeaf(ctx, f, cmd)
+			}
+			if name == "" {
+				return Helpf(ctx, c.tr("please provide a subcommand"))
+			}
+
+			subcmd, ok := subcmds[name]
+			if !ok && fromEnv {
+				return Helpf(ctx, c.tr("unknown subcommand in $%v: %q"), c.DefaultCommandEnv, name)
+			}
+			if !ok {
+				panicRegistration(fullname, "default subcommand %q does not exist", name)
+			}
+			ctx = context.WithValue(ctx, fullnameKey{}, fullname+" "+subcmd.Name())
+			return run(ctx, nil, subcmd, persistent)
+		}
+
+		subcmd, ok := subcmds[f.Arg(0)]
+		if !ok && c.AllowPrefixMatch {
+			matches := matchPrefix(subcmds, f.Arg(0))
+			if len(matches) > 1 {
+				return Helpf(ctx, c.tr("ambiguous subcommand %q could be: %v"), f.Arg(0), strings.Join(matches, ", "))
+			}
+			if len(matches) == 1 {
+				subcmd, ok = subcmds[matches[0]]
+			}
+		}
+		if ok {
+			ctx = context.WithValue(ctx, fullnameKey{}, fullname+" "+subcmd.Name())
+			return run(ctx, f.Args()[1:], subcmd, persistent)
+		}
+		if isLeaf(cmd) {
+			return dispatchLeaf(ctx, f, cmd)
+		}
+		if c.ExternalSubcommands {
+			if status, ok := runExternal(ctx, f.Args()); ok {
+				return status
+			}
+		}
+
+		if suggestion, ok := suggest(subcmds, f.Arg(0)); ok {
+			return Helpf(ctx, c.tr("unknown subcommand: %q\ndid you mean %q?"), f.Arg(0), suggestion)
+		}
+		return Helpf(ctx, c.tr("unknown subcommand: %q"), f.Arg(0))
+	case Leaf, LeafE:
+		return dispatchLeaf(ctx, f, cmd)
+	default:
+		panicRegistration(fullname, "%T does not implement cli.Leaf, cli.LeafE or cli.Branch", cmd)
+		panic("unreachable")
+	}
+}
+
+// runExternal runs the external subcommand args[0] of the invoked
+// branch with the rest of args. It reports whether the subcommand's
+// executable was found.
+func runExternal(ctx context.Context, args []string) (int, bool) {
+	name := strings.Replace(FullName(ctx), " ", "-", -1) + "-" + args[0]
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return 0, false
+	}
+
+	return prepared(ctx, func(ctx context.Context) int {
+		cmd := exec.CommandContext(ctx, path, args[1:]...)
+		cmd.Stdin = Stdin(ctx)
+		cmd.Stdout = Stdout(ctx)
+		cmd.Stderr = Stderr(ctx)
+		err := cmd.Run()
+		if err != nil {
+			var eerr *exec.ExitError
+			if !xerrors.As(err, &eerr) {
+				fmt.Fprintf(Stderr(ctx), "%v: failed to run %v: %v\n", FullName(ctx), name, err)
+			}
+		}
+		return ExitCode(err)
+	}), true
+}
+
+// Resolve returns the command that args would invoke if cmd was run
+// with them along with the arguments that would be passed to it,
+// including its flags, without running anything. Flags are skipped
+// over but not parsed. It returns an error if a subcommand does
+// not exist.
+func Resolve(cmd Command, args []string) (Command, []string, error) {
+	return NewConfig().Resolve(cmd, args)
+}
+
+// Resolve is like the package level Resolve but with the settings in c.
+func (c *Config) Resolve(cmd Command, args []string) (Command, []string, error) {
+	_, cmd, _, args, err := c.resolve(cmd, args)
+	return cmd, args, err
+}
+
+// resolve is like Resolve but also returns the full name of the
+// resolved command and the flagset its arguments would be parsed with.
+func (c *Config) resolve(cmd Command, args []string) (string, Command, *flag.FlagSet, []string, error) {
+	fullname := c.rootName(cmd)
+	persistent, _, _ := c.rootFlags()
+	cache := newFlagCache()
+	for root := true; ; root = false {
+		var f *flag.FlagSet
+		f, persistent = c.newFlagSet(fullname, cmd, persistent, cache)
+		c.builtinFlags(f)
+
+		cmdb, ok := cmd.(Branch)
+		if !ok {
+			return fullname, cmd, f, args, nil
+		}
+		subcmds := subcommands(fullname, cmdb)
+
+		subArgs, rest := splitArgs(f, args, true)
+		if len(subArgs) == 0 {
+			name, fromEnv := c.defaultSubcommand(cmd, root)
+			if name == "" {
+				return fullname, cmd, f, args, nil
+			}
+			subcmd, ok := subcmds[name]
+			if !ok && fromEnv {
+				return "", nil, nil, nil, fmt.Errorf("%v: unknown subcommand in $%v: %q", fullname, c.DefaultCommandEnv, name)
+			}
+			if !ok {
+				panicRegistration(fullname, "default subcommand %q does not exist", name)
+			}
+			fullname += " " + subcmd.Name()
+			cmd = subcmd
+			args = nil
+			continue
+		}
+
+		subcmd, ok := subcmds[subArgs[0]]
+		if !ok && c.AllowPrefixMatch {
+			if matches := matchPrefix(subcmds, subArgs[0]); len(matches) == 1 {
+				subcmd, ok = subcmds[matches[0]]
+			}
+		}
+		if !ok {
+			if isLeaf(cmd) {
+				return fullname, cmd, f, args, nil
+			}
+			return "", nil, nil, nil, fmt.Errorf("%v: unknown subcommand: %q", fullname, subArgs[0])
+		}
+
+		fullname += " " + subcmd.Name()
+		cmd = subcmd
+		// After --, splitArgs returns all of the arguments in subArgs.
+		args = append(subArgs[1:len(subArgs):len(subArgs)], rest...)
+	}
+}
+
+// dispatchLeaf runs cmd, a Leaf or LeafE, with the arguments
+// remaining in f after checking their number.
+func dispatchLeaf(ctx context.Context, f *flag.FlagSet, cmd Command) int {
+	if cmd, ok := cmd.(interface {
+		NArgs() (min, max int)
+	}); ok {
+		min, max := cmd.NArgs()
+		if msg := config(ctx).checkNArgs(f.NArg(), min, max); msg != "" {
+			return Helpf(ctx, "%v", msg)
+		}
+	}
+	return prepared(ctx, func(ctx context.Context) int {
+		return runLeaf(ctx, cmd, f.Args())
+	})
+}
+
+// PrintTree writes an overview of cmd and all of its descendants
+// to w, one per line and indented by depth, along with their usage
+// and the first sentence of their descriptions.
+func PrintTree(w io.Writer, cmd Command) error {
+	return NewConfig().PrintTree(w, cmd)
+}
+
+// PrintTree is like the package level PrintTree
+// but with the settings in c.
+func (c *Config) PrintTree(w io.Writer, cmd Command) error {
+	tw := c.newTabWriter(w, c.helpWidth(w))
+	c.walk(cmd, func(fullname string, cmd Command, f *flag.FlagSet) {
+		depth := strings.Count(fullname, " ")
+		fmt.Fprintf(tw, "%v%v\t%v", strings.Repeat("  ", depth), strings.Join(names(cmd), ", "), usage(cmd, f))
+		if cmd.Desc() != "" {
+			fmt.Fprintf(tw, "\t%v", summary(cmd))
+		}
+		fmt.Fprintf(tw, "\n")
+	})
+	return tw.Flush()
+}
+
+// version returns the version of the CLI.
+func (c *Config) version() string {
+	if c.VersionFunc != nil {
+		return c.VersionFunc()
+	}
+	if c.Version != "" {
+		return c.Version
+	}
+	return Version
+}
+
+// builtinFlags registers the flags that every command accepts.
+// A builtin flag is skipped if the command defines a flag
+// with the same name.
+func (c *Config) builtinFlags(f *flag.FlagSet) (help *helpValue, version *bool) {
+	help = &helpValue{}
+	if f.Lookup("help") == nil {
+		f.Var(help, "help", c.tr("Print help and exit. Use -help=json for a JSON description."))
+	}
+	version = new(bool)
+	if f.Lookup("version") == nil {
+		f.BoolVar(version, "version", false, c.tr("Print version and exit."))
+	}
+	return help, version
+}
+
+// helpValue is the value of the -help flag. It is a bool flag
+// that also accepts json to request help as JSON.
+type helpValue struct {
+	help bool
+	json bool
+}
+
+func (h *helpValue) Set(s string) error {
+	if s == "json" {
+		h.help, h.json = true, true
+		return nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return xerrors.New("must be a boolean or json")
+	}
+	h.help, h.json = v, false
+	return nil
+}
+
+func (h *helpValue) String() string {
+	if h == nil {
+		return "false"
+	}
+	if h.json {
+		return "json"
+	}
+	return strconv.FormatBool(h.help)
+}
+
+func (h *helpValue) IsBoolFlag() bool {
+	return true
+}
+
+// walk calls fn for cmd and all of its descendants in help order.
+// f is the flagset the command would parse its arguments with.
+func (c *Config) walk(cmd Command, fn func(fullname string, cmd Command, f *flag.FlagSet)) {
+	cache := newFlagCache()
+	var walkCmd func(fullname string, cmd Command, persistent []*flag.Flag)
+	walkCmd = func(fullname string, cmd Command, persistent []*flag.Flag) {
+		f, persistent := c.newFlagSet(fullname, cmd, persistent, cache)
+		c.builtinFlags(f)
+
+		fn(fullname, cmd, f)
+
+		if cmd, ok := cmd.(Branch); ok {
+			for _, subcmd := range visibleSubcommands(cmd) {
+				walkCmd(fullname+" "+subcmd.Name(), subcmd, persistent)
+			}
+		}
+	}
+	persistent, _, _ := c.rootFlags()
+	walkCmd(c.rootName(cmd), cmd, persistent)
+}
+
+// rootName returns the name of the root command cmd.
+func (c *Config) rootName(cmd Command) string {
+	if c.ProgramName != "" {
+		return c.ProgramName
+	}
+	return cmd.Name()
+}
+
+// subcommands returns the subcommands of cmd keyed by their
+// names and aliases.
+// It panics if two of them share a name or alias.
+func subcommands(fullname string, cmd Branch) map[string]Command {
+	subcmds := make(map[string]Command)
+	for _, subcmd := range cmd.Subcommands() {
+		for _, name := range names(subcmd) {
+			if prev, ok := subcmds[name]; ok {
+				panicNameConflict(fullname, name, prev, subcmd)
+			}
+			subcmds[name] = subcmd
+		}
+	}
+	return subcmds
+}
+
+// panicNameConflict panics with a RegistrationError describing
+// how the subcommands prev and cmd of fullname both claim name.
+func panicNameConflict(fullname, name string, prev, cmd Command) {
+	switch {
+	case prev == cmd:
+		panicRegistration(fullname, "command %q has the name %q more than once", cmd.Name(), name)
+	case prev.Name() == name && cmd.Name() == name:
+		panicRegistration(fullname, "duplicate command name %q", name)
+	case prev.Name() == name:
+		panicRegistration(fullname, "alias %q of command %q shadows command %q", name, cmd.Name(), prev.Name())
+	case cmd.Name() == name:
+		panicRegistration(fullname, "alias %q of command %q shadows command %q", name, prev.Name(), cmd.Name())
+	default:
+		panicRegistration(fullname, "commands %q and %q both have the alias %q", prev.Name(), cmd.Name(), name)
+	}
+}
+
+// checkNames panics if any branch in the tree of cmd has
+// subcommands that share a name or alias so that misconfigured
+// trees are caught whatever command is invoked.
+func checkNames(fullname string, cmd Command) {
+	bcmd, ok := cmd.(Branch)
+	if !ok {
+		return
+	}
+	subcommands(fullname, bcmd)
+	for _, subcmd := range bcmd.Subcommands() {
+		checkNames(fullname+" "+subcmd.Name(), subcmd)
+	}
+}
+
+// visibleSubcommands returns the subcommands of cmd that are not
+// hidden sorted by name so that they are displayed in a deterministic
+// order.
+func visibleSubcommands(cmd Branch) []Command {
+	var subcmds []Command
+	for _, subcmd := range cmd.Subcommands() {
+		if !isHidden(subcmd) {
+			subcmds = append(subcmds, subcmd)
+		}
+	}
+	sort.SliceStable(subcmds, func(i, j int) bool {
+		return subcmds[i].Name() < subcmds[j].Name()
+	})
+	return subcmds
+}
+
+// isHidden reports whether cmd is hidden from help.
+func isHidden(cmd Command) bool {
+	hcmd, ok := cmd.(Hideable)
+	return ok && hcmd.Hidden()
+}
+
+// defaultSubcommand returns the name of the subcommand to run when cmd
+// is invoked without one or "" if there is none. fromEnv reports whether
+// it came from DefaultCommandEnv, which only applies to the root.
+func (c *Config) defaultSubcommand(cmd Command, root bool) (name string, fromEnv bool) {
+	if root && c.DefaultCommandEnv != "" {
+		if name := os.Getenv(c.DefaultCommandEnv); name != "" {
+			return name, true
+		}
+	}
+	if dcmd, ok := cmd.(Defaulter); ok {
+		return dcmd.Default(), false
+	}
+	return "", false
+}
+
+// deprecation returns the deprecation of cmd
+// or the zero Deprecation if it is not deprecated.
+func deprecation(cmd Command) Deprecation {
+	switch dcmd := cmd.(type) {
+	case DeprecatableInfo:
+		return dcmd.DeprecatedInfo()
+	case Deprecatable:
+		return Deprecation{Message: dcmd.Deprecated()}
+	}
+	return Deprecation{}
+}
+
+// matchPrefix returns the sorted names of the visible commands in
+// subcmds that have a name or alias starting with prefix.
+func matchPrefix(subcmds map[string]Command, prefix string) []string {
+	seen := make(map[string]bool)
+	var matches []string
+	for name, subcmd := range subcmds {
+		if !strings.HasPrefix(name, prefix) || isHidden(subcmd) || seen[subcmd.Name()] {
+			continue
+		}
+		seen[subcmd.Name()] = true
+		matches = append(matches, subcmd.Name())
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// suggest returns the name in subcmds closest to name
+// if it is within an edit distance of 2.
+func suggest(subcmds map[string]Command, name string) (string, bool) {
+	best := ""
+	bestDist := 3
+	for subname, subcmd := range subcmds {
+		if isHidden(subcmd) {
+			continue
+		}
+		dist := levenshtein(name, subname)
+		if dist < bestDist || dist == bestDist && subname < best {
+			best = subname
+			bestDist = dist
+		}
+	}
+	return best, best != ""
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(br)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// names returns the name of cmd followed by its aliases.
+func names(cmd Command) []string {
+	names := []string{cmd.Name()}
+	if cmd, ok := cmd.(Aliased); ok {
+		names = append(names, cmd.Aliases()...)
+	}
+	return names
+}
+
+func usage(cmd Command, f *flag.FlagSet) string {
+	usage := ""
+
+	appendUsage := func(str string) {
+		if str == "" {
+			return
+		}
+
+		if usage != "" {
+			usage += " "
+		}
+		usage += str
+	}
+
+	if countFlags(f) > 0 {
+		appendUsage("[flags...]")
+	}
+
+	_, branch := cmd.(Branch)
+	switch {
+	case branch && isLeaf(cmd):
+		appendUsage("[<subcmd>]")
+	case branch:
+		appendUsage("<subcmd>")
+	}
+
+	leafUsage := ""
+	switch cmd := cmd.(type) {
+	case Leaf:
+		leafUsage = trimFlagsUsage(cmd.Usage())
+	case LeafE:
+		leafUsage = trimFlagsUsage(cmd.Usage())
+	}
+	if cmd, ok := cmd.(ArgDescribed); ok && leafUsage == "" {
+		for _, arg := range cmd.PositionalArgs() {
+			appendUsage(arg.Name)
+		}
+	}
+	appendUsage(leafUsage)
+
+	return usage
+}
+
+// trimFlagsUsage removes a leading flags field from the usage of a leaf
+// as one is added automatically.
+func trimFlagsUsage(usage string) string {
+	for _, prefix := range []string{"[flags...]", "[flags]"} {
+		if strings.HasPrefix(usage, prefix) {
+			return strings.TrimSpace(usage[len(prefix):])
+		}
+	}
+	return usage
+}
+
+// summary returns the first line of the command's description.
+func summary(cmd Command) string {
+	return strings.Split(cmd.Desc(), "\n")[0]
+}
+
+func countFlags(f *flag.FlagSet) int {
+	var flagsCount int
+	f.VisitAll(func(_ *flag.Flag) {
+		flagsCount++
+	})
+	return flagsCount
+}
+
+// isLeaf reports whether cmd implements Leaf or LeafE.
+func isLeaf(cmd Command) bool {
+	switch cmd.(type) {
+	case Leaf, LeafE:
+		return true
+	}
+	return false
+}
+
+// runLeaf runs cmd, a Leaf or LeafE, with args, enforcing Timeout
+// and recovering panics if RecoverPanics is set.
+func runLeaf(ctx context.Context, cmd Command, args []string) (status int) {
+	c := config(ctx)
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+		defer func() {
+			if ctx.Err() == context.DeadlineExceeded {
+				fmt.Fprintf(c.stderr(), "%v: command timed out after %v\n", FullName(ctx), c.Timeout)
+				status = StatusTimeout
+			}
+		}()
+	}
+
+	if c.RecoverPanics {
+		defer func() {
+			r := recover()
+			if r != nil {
+				fmt.Fprintf(c.stderr(), "%v: panic: %v\n", FullName(ctx), r)
+				status = StatusPanic
+			}
+		}()
+	}
+
+	run := func(ctx context.Context, args []string) int {
+		if debug() {
+			var done func()
+			ctx, done = watchContext(ctx)
+			defer done()
+		}
+		return runLeafFunc(ctx, cmd, args)
+	}
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		run = c.Middleware[i](run)
+	}
+	return run(ctx, args)
+}
+
+// runLeafFunc calls the Run or RunE method of cmd.
+func runLeafFunc(ctx context.Context, cmd Command, args []string) int {
+	if cmd, ok := cmd.(Leaf); ok {
+		return cmd.Run(ctx, args)
+	}
+
+	err := cmd.(LeafE).RunE(ctx, args)
+	if err == nil {
+		return StatusOK
+	}
+	fmt.Fprintf(config(ctx).stderr(), "%v: %v\n", FullName(ctx), err)
+
+	var ec interface {
+		ExitCode() int
+	}
+	if xerrors.As(err, &ec) {
+		return ec.ExitCode()
+	}
+	return StatusError
+}
+
+// checkNArgs returns an error message if n is not within min and max.
+func (c *Config) checkNArgs(n, min, max int) string {
+	switch {
+	case min == max && n != min:
+		return fmt.Sprintf(c.tr("expected %v, got %v"), c.pluralArgs(min), n)
+	case n < min:
+		return fmt.Sprintf(c.tr("expected at least %v, got %v"), c.pluralArgs(min), n)
+	case max >= 0 && n > max:
+		return fmt.Sprintf(c.tr("expected at most %v, got %v"), c.pluralArgs(max), n)
+	}
+	return ""
+}
+
+func (c *Config) pluralArgs(n int) string {
+	if n == 1 {
+		return c.tr("1 argument")
+	}
+	return fmt.Sprintf(c.tr("%v arguments"), n)
+}
+
+// parse parses args with f.
+// The flag package is prevented from printing the error and
+// usage itself so that run can report them.
+func (c *Config) parse(f *flag.FlagSet, args []string, interspersed bool) error {
+	usage, out := f.Usage, f.Output()
+	f.Usage = func() {}
+	f.SetOutput(ioutil.Discard)
+	defer func() {
+		f.Usage = usage
+		f.SetOutput(out)
+	}()
+
+	if c.AllowFlagPrefix {
+		var err error
+		args, err = c.expandFlagPrefixes(f, args, interspersed)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if interspersed {
+		err = parseInterspersed(f, args)
+	} else {
+		err = f.Parse(args)
+	}
+	if err != nil {
+		return redactParseError(f, err)
+	}
+	return nil
+}
+
+// redactParseError returns err with the value replaced with redacted
+// if err is the flag package's error about an invalid value for a
+// secret flag.
+func redactParseError(f *flag.FlagSet, err error) error {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "invalid value ") {
+		return err
+	}
+	f.VisitAll(func(fl *flag.Flag) {
+		if redact(fl, "") != redacted {
+			return
+		}
+		i := strings.LastIndex(msg, " for flag -"+fl.Name+": ")
+		if i < 0 {
+			return
+		}
+		err = fmt.Errorf("invalid value %q%v", redacted, msg[i:])
+	})
+	return err
+}
+
+// expandFlagPrefixes returns args with the flags passed by an
+// unambiguous prefix of their name replaced with their full name.
+// Like the flag package, it stops at -- and, unless interspersed is
+// set, at the first argument.
+func (c *Config) expandFlagPrefixes(f *flag.FlagSet, args []string, interspersed bool) ([]string, error) {
+	args = append([]string(nil), args...)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			if !interspersed {
+				break
 			}
+			continue
+		}
+
+		dashes := "-"
+		if arg[1] == '-' {
+			dashes = "--"
+		}
+		name := arg[len(dashes):]
+		value := ""
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value = name[:j], name[j:]
+		}
+		// -h is left to the flag package to print help.
+		if name == "" || name == "h" {
+			continue
 		}
 
-		os.Stderr.Write(b.Bytes())
+		fl := f.Lookup(name)
+		if fl == nil {
+			var matches []*flag.Flag
+			f.VisitAll(func(fl *flag.Flag) {
+				if strings.HasPrefix(fl.Name, name) && !isHiddenFlag(fl) {
+					matches = append(matches, fl)
+				}
+			})
+			if len(matches) > 1 {
+				var names []string
+				for _, fl := range matches {
+					names = append(names, "-"+fl.Name)
+				}
+				return nil, fmt.Errorf(c.tr("ambiguous flag -%v could be: %v"), name, strings.Join(names, ", "))
+			}
+			if len(matches) == 0 {
+				continue
+			}
+			fl = matches[0]
+			args[i] = dashes + fl.Name + value
+		}
+
+		// Skip the value of the flag so that it is not
+		// mistaken for a flag itself.
+		if value == "" && !isBoolFlag(fl) {
+			i++
+		}
+	}
+	return args, nil
+}
+
+// parseInterspersed parses args with f allowing flags to follow
+// arguments. Flag parsing still stops at --.
+func parseInterspersed(f *flag.FlagSet, args []string) error {
+	var positional []string
+	for {
+		err := f.Parse(args)
+		if err != nil {
+			return err
+		}
+
+		rest := f.Args()
+		parsed := args[:len(args)-len(rest)]
+		if len(rest) == 0 || len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
 	}
 
+	// Parsing -- followed by the arguments makes them the
+	// arguments of f without treating any of them as flags.
+	return f.Parse(append([]string{"--"}, positional...))
+}
+
+// newFlagSet creates the flagset for cmd.
+// It returns the flagset along with the persistent flags
+// that should be inherited by the subcommands of cmd.
+func (c *Config) newFlagSet(fullname string, cmd Command, persistent []*flag.Flag, cache *flagCache) (*flag.FlagSet, []*flag.Flag) {
+	f := flag.NewFlagSet(fullname, flag.ContinueOnError)
+	f.SetOutput(c.stderr())
+
+	// Var is used instead of registering the flags again as that would
+	// reset the values already parsed by the ancestors.
+	for _, pf := range persistent {
+		copyFlag(f, pf)
+	}
+
+	if cmd, ok := cmd.(Persistent); ok {
+		cache.persistentFlags(fullname, cmd).VisitAll(func(pf *flag.Flag) {
+			if f.Lookup(pf.Name) != nil {
+				panicRegistration(fullname, "persistent flag -%v collides with an inherited persistent flag", pf.Name)
+			}
+			copyFlag(f, pf)
+		})
+		persistent = nil
+		f.VisitAll(func(pf *flag.Flag) {
+			persistent = append(persistent, pf)
+		})
+	}
+
+	cache.localFlags(fullname, cmd).VisitAll(func(lf *flag.Flag) {
+		if f.Lookup(lf.Name) != nil {
+			panicRegistration(fullname, "flag -%v collides with a persistent flag", lf.Name)
+		}
+		copyFlag(f, lf)
+	})
+
+	return f, persistent
+}
+
+// copyFlag defines fl in f with the same value and default.
+func copyFlag(f *flag.FlagSet, fl *flag.Flag) {
+	f.Var(fl.Value, fl.Name, fl.Usage)
+	f.Lookup(fl.Name).DefValue = fl.DefValue
+}
+
+// flagCache holds the flags each command registers in Flags and
+// PersistentFlags by full name so that they are only called once per
+// command in a run even when the flagset is built again, e.g. each
+// time help is printed.
+type flagCache struct {
+	local      map[string]*flag.FlagSet
+	persistent map[string]*flag.FlagSet
+}
+
+func newFlagCache() *flagCache {
+	return &flagCache{
+		local:      make(map[string]*flag.FlagSet),
+		persistent: make(map[string]*flag.FlagSet),
+	}
+}
+
+// localFlags returns the flags cmd registers in Flags.
+func (c *flagCache) localFlags(fullname string, cmd Command) *flag.FlagSet {
+	f, ok := c.local[fullname]
+	if !ok {
+		f = flag.NewFlagSet(fullname, flag.ContinueOnError)
+		cmd.Flags(f)
+		c.local[fullname] = f
+	}
+	return f
+}
+
+// persistentFlags returns the flags cmd registers in PersistentFlags.
+func (c *flagCache) persistentFlags(fullname string, cmd Persistent) *flag.FlagSet {
+	f, ok := c.persistent[fullname]
+	if !ok {
+		f = flag.NewFlagSet(fullname, flag.ContinueOnError)
+		cmd.PersistentFlags(f)
+		c.persistent[fullname] = f
+	}
 	return f
 }
 
+// initFlagSet creates the flagset for cmd along with a function that
+// writes its help to w. The flagset's Usage writes the help to Stderr.
+// root is whether cmd is the root command, whose help lists Topics.
+func (c *Config) initFlagSet(fullname string, cmd Command, root bool, persistent []*flag.Flag, cache *flagCache) (*flag.FlagSet, func(w io.Writer), []*flag.Flag) {
+	f, persistent := c.newFlagSet(fullname, cmd, persistent, cache)
+
+	help := func(w io.Writer) {
+		var b bytes.Buffer
+		color := colorizer(c.useColor(w))
+		width := c.helpWidth(w)
+
+		fmt.Fprintf(&b, "%v\n\t%v %v\n", color.header(c.tr("Usage:")), color.name(fullname), usage(cmd, f))
+
+		if c.ShowVersionInHelp {
+			fmt.Fprintf(&b, "\n%v %v\n", color.header(c.tr("Version:")), c.version())
+		}
+
+		if cmd.Desc() != "" {
+			fmt.Fprintf(&b, "\n%v\n", wrap(cmd.Desc(), width))
+		}
+
+		if cmd, ok := cmd.(ArgDescribed); ok && len(cmd.PositionalArgs()) > 0 {
+			fmt.Fprintf(&b, "\n%v\n", color.header(c.tr("Arguments:")))
+			c.writeArgs(&b, width, cmd.PositionalArgs())
+		}
+
+		if cmd, ok := cmd.(Exampled); ok && len(cmd.Examples()) > 0 {
+			fmt.Fprintf(&b, "\n%v\n", color.header(c.tr("Examples:")))
+			for _, ex := range cmd.Examples() {
+				fmt.Fprintf(&b, "  %v\n", ex)
+			}
+		}
+
+		if countFlags(f) > 0 {
+			fmt.Fprintf(&b, "\n%v\n", color.header(c.tr("Flags:")))
+			printFlags(&b, f, "")
+			for _, g := range flagGroups(f) {
+				fmt.Fprintf(&b, "\n%v\n", color.header(g+":"))
+				printFlags(&b, f, g)
+			}
+		}
+
+		if cmd, ok := cmd.(Branch); ok {
+			c.writeSubcommands(&b, color, width, fullname, cmd, persistent, cache)
+		}
+
+		if root && len(c.Topics) > 0 {
+			c.writeTopics(&b, color, width, fullname)
+		}
+
+		c.writeHelp(w, b.Bytes())
+	}
+	f.Usage = func() {
+		help(c.stderr())
+	}
+
+	return f, help, persistent
+}
+
+// writeArgs writes the names and descriptions of args
+// aligned in two columns.
+func (c *Config) writeArgs(w io.Writer, width int, args []ArgDef) {
+	tw := c.newTabWriter(w, width)
+	for _, arg := range args {
+		fmt.Fprintf(tw, "  %v\t%v\n", arg.Name, arg.Desc)
+	}
+	err := tw.Flush()
+	if err != nil {
+		panicf("tabwriter flush error: %v", err)
+	}
+}
+
+// newTabWriter returns a tabwriter that aligns the columns of
+// a listing in help that is width columns wide.
+func (c *Config) newTabWriter(w io.Writer, width int) *tabwriter.Writer {
+	padding := c.HelpPadding
+	if padding <= 0 {
+		padding = 4
+		if width < 80 {
+			padding = 2
+		}
+	}
+	return tabwriter.NewWriter(w, 0, 0, padding, ' ', 0)
+}
+
+// helpOutput returns where help requested with -help is written.
+func (c *Config) helpOutput() io.Writer {
+	if c.HelpToStdout {
+		return c.stdout()
+	}
+	return c.stderr()
+}
+
+// helpWidth returns the width to wrap help written to w to.
+func (c *Config) helpWidth(w io.Writer) int {
+	if c.HelpWidth > 0 {
+		return c.HelpWidth
+	}
+	if f, ok := w.(*os.File); ok && isTerminal(f) {
+		if width, _, ok := terminalSize(f); ok {
+			return width
+		}
+	}
+	return 80
+}
+
+// wrap wraps each line of s to width.
+// Lines are only broken between words so a word longer than
+// width gets a line of its own. The indentation of a line is
+// kept for the lines it is wrapped into.
+func wrap(s string, width int) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+		var wrapped []string
+		cur := indent
+		for _, word := range strings.Fields(line) {
+			if cur != indent && len(cur)+1+len(word) > width {
+				wrapped = append(wrapped, cur)
+				cur = indent
+			}
+			if cur != indent {
+				cur += " "
+			}
+			cur += word
+		}
+		if cur != indent || len(wrapped) == 0 {
+			wrapped = append(wrapped, cur)
+		}
+		lines[i] = strings.Join(wrapped, "\n")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeSubcommands writes the subcommands section of the help of cmd
+// to w. Subcommands in a group are listed in a section named after
+// the group after the ungrouped subcommands.
+// If the names and usages of the subcommands take up more than half
+// of width, their descriptions are written on the lines below them
+// instead of in a column of their own.
+func (c *Config) writeSubcommands(w io.Writer, color colorizer, width int, fullname string, cmd Branch, persistent []*flag.Flag, cache *flagCache) {
+	groups := make(map[string][]Command)
+	var groupNames []string
+	for _, subcmd := range visibleSubcommands(cmd) {
+		g := group(subcmd)
+		if _, ok := groups[g]; !ok && g != "" {
+			groupNames = append(groupNames, g)
+		}
+		groups[g] = append(groups[g], subcmd)
+	}
+	sort.Strings(groupNames)
+	if len(groups[""]) > 0 {
+		groupNames = append([]string{""}, groupNames...)
+	}
+
+	type row struct {
+		names string
+		usage string
+		desc  string
+	}
+	rows := make(map[string][]row)
+	var namesWidth, usageWidth int
+	for _, g := range groupNames {
+		for _, subcmd := range groups[g] {
+			f2, _ := c.newFlagSet(fullname+" "+subcmd.Name(), subcmd, persistent, cache)
+			c.builtinFlags(f2)
+			r := row{
+				names: strings.Join(names(subcmd), ", "),
+				usage: usage(subcmd, f2),
+				desc:  summary(subcmd),
+			}
+			if d := deprecation(subcmd); d.RemovedIn != "" {
+				r.desc = strings.TrimSpace(r.desc + " " + fmt.Sprintf(c.tr("(deprecated, will be removed in %v)"), d.RemovedIn))
+			} else if d != (Deprecation{}) {
+				r.desc = strings.TrimSpace(r.desc + " " + c.tr("(deprecated)"))
+			}
+			if len(r.names) > namesWidth {
+				namesWidth = len(r.names)
+			}
+			if len(r.usage) > usageWidth {
+				usageWidth = len(r.usage)
+			}
+			rows[g] = append(rows[g], r)
+		}
+	}
+	stacked := 2+namesWidth+1+usageWidth > width/2
+
+	tw := c.newTabWriter(w, width)
+	for _, g := range groupNames {
+		header := c.tr("Subcommands:")
+		if g != "" {
+			header = g + ":"
+		}
+		fmt.Fprintf(tw, "\n%v\n", color.header(header))
+
+		for _, r := range rows[g] {
+			if stacked {
+				fmt.Fprintf(tw, "  %v %v\n", color.name(r.names), r.usage)
+				if r.desc != "" {
+					fmt.Fprintf(tw, "%v\n", wrap("      "+r.desc, width))
+				}
+				continue
+			}
+			fmt.Fprintf(tw, "  %v\t%v", color.name(r.names), r.usage)
+			if r.desc != "" {
+				fmt.Fprintf(tw, "\t%v", r.desc)
+			}
+			fmt.Fprintf(tw, "\n")
+		}
+	}
+	err := tw.Flush()
+	if err != nil {
+		panicf("tabwriter flush error: %v", err)
+	}
+}
+
+// group returns the group of cmd or "" if it is not in one.
+func group(cmd Command) string {
+	gcmd, ok := cmd.(Grouped)
+	if !ok {
+		return ""
+	}
+	return gcmd.Group()
+}
+
+// RegistrationError is the value panicked with when a command
+// is misconfigured, e.g. when two subcommands share a name.
+// Tests can recover it to check for misconfiguration.
+type RegistrationError struct {
+	// Command is the full name of the misconfigured command.
+	Command string
+	// Reason describes what is wrong with the command.
+	Reason string
+}
+
+func (e *RegistrationError) Error() string {
+	return fmt.Sprintf("cli: %v: %v", e.Command, e.Reason)
+}
+
+func panicRegistration(command string, reason string, v ...interface{}) {
+	panic(&RegistrationError{
+		Command: command,
+		Reason:  fmt.Sprintf(reason, v...),
+	})
+}
+
 func panicf(f string, v ...interface{}) {
 	panic(fmt.Sprintf("cli: "+f, v...))
 }
 
 type (
-	usageKey    struct{}
-	fullnameKey struct{}
+	usageKey     struct{}
+	fullnameKey  struct{}
+	flagSetKey   struct{}
+	usageLineKey struct{}
+	dryRunKey    struct{}
+	logPrefixKey struct{}
+	flagCacheKey struct{}
+	traceIDKey   struct{}
+	rootKey      struct{}
+	stdioKey     struct{}
+	prepareKey   struct{}
+	configKey    struct{}
 )
@@ -0,0 +1,2152 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testLeaf struct {
+	name    string
+	aliases []string
+	flags   func(f *flag.FlagSet)
+	run     func(ctx context.Context, args []string) int
+}
+
+func (l *testLeaf) Name() string      { return l.name }
+func (l *testLeaf) Desc() string      { return "Test leaf." }
+func (l *testLeaf) Usage() string     { return "" }
+func (l *testLeaf) Aliases() []string { return l.aliases }
+
+func (l *testLeaf) Flags(f *flag.FlagSet) {
+	if l.flags != nil {
+		l.flags(f)
+	}
+}
+
+func (l *testLeaf) Run(ctx context.Context, args []string) int {
+	if l.run != nil {
+		return l.run(ctx, args)
+	}
+	return 0
+}
+
+type testBranch struct {
+	name    string
+	aliases []string
+	flags   func(f *flag.FlagSet)
+	subcmds []Command
+}
+
+func (b *testBranch) Name() string           { return b.name }
+func (b *testBranch) Desc() string           { return "Test branch." }
+func (b *testBranch) Aliases() []string      { return b.aliases }
+func (b *testBranch) Subcommands() []Command { return b.subcmds }
+
+func (b *testBranch) Flags(f *flag.FlagSet) {
+	if b.flags != nil {
+		b.flags(f)
+	}
+}
+
+// runTest runs cmd with args and returns the status
+// along with everything written to Stdout and Stderr.
+func runTest(t *testing.T, cmd Command, args ...string) (status int, stdout, stderr string) {
+	t.Helper()
+	return runTestConfig(t, NewConfig(), cmd, args...)
+}
+
+// runTestConfig is like runTest but runs cmd with the settings in c.
+func runTestConfig(t *testing.T, c *Config, cmd Command, args ...string) (status int, stdout, stderr string) {
+	t.Helper()
+
+	var outb, errb bytes.Buffer
+	c.Stdout, c.Stderr = &outb, &errb
+
+	status = c.RunStatus(context.Background(), cmd, args)
+	return status, outb.String(), errb.String()
+}
+
+func TestAliases(t *testing.T) {
+	var ran string
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name:    "ls",
+				aliases: []string{"list"},
+				run: func(ctx context.Context, args []string) int {
+					ran = FullName(ctx)
+					return 0
+				},
+			},
+		},
+	}
+
+	status, _, _ := runTest(t, root, "list")
+	if status != 0 {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	if ran != "root ls" {
+		t.Fatalf("unexpected fullname: %q", ran)
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	if !strings.Contains(stderr, "ls, list") {
+		t.Fatalf("help does not list aliases: %q", stderr)
+	}
+}
+
+func TestAliasCollision(t *testing.T) {
+	testCases := []struct {
+		name    string
+		subcmds []Command
+		command string
+		reason  string
+	}{
+		{
+			name: "shadowsName",
+			subcmds: []Command{
+				&testLeaf{name: "ls", aliases: []string{"list"}},
+				&testLeaf{name: "list"},
+			},
+			command: "root",
+			reason:  `alias "list" of command "ls" shadows command "list"`,
+		},
+		{
+			name: "sharedAlias",
+			subcmds: []Command{
+				&testLeaf{name: "rm", aliases: []string{"d"}},
+				&testLeaf{name: "del", aliases: []string{"d"}},
+			},
+			command: "root",
+			reason:  `commands "rm" and "del" both have the alias "d"`,
+		},
+		{
+			name: "duplicateName",
+			subcmds: []Command{
+				&testLeaf{name: "ls"},
+				&testLeaf{name: "ls"},
+			},
+			command: "root",
+			reason:  `duplicate command name "ls"`,
+		},
+		{
+			name: "nested",
+			subcmds: []Command{
+				&testLeaf{name: "ls"},
+				&testBranch{
+					name: "remote",
+					subcmds: []Command{
+						&testLeaf{name: "add"},
+						&testLeaf{name: "rm", aliases: []string{"add"}},
+					},
+				},
+			},
+			command: "root remote",
+			reason:  `alias "add" of command "rm" shadows command "add"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		func() {
+			root := &testBranch{
+				name:    "root",
+				subcmds: tc.subcmds,
+			}
+
+			defer func() {
+				err, ok := recover().(*RegistrationError)
+				if !ok || err.Command != tc.command || err.Reason != tc.reason {
+					t.Errorf("%v: unexpected panic: %#v", tc.name, err)
+				}
+			}()
+			runTest(t, root, "ls")
+		}()
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	subcmds := map[string]Command{
+		"ls":      nil,
+		"install": nil,
+		"remove":  nil,
+	}
+
+	testCases := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{name: "sl", want: "ls", ok: true},
+		{name: "instal", want: "install", ok: true},
+		{name: "rmove", want: "remove", ok: true},
+		{name: "mkdir", ok: false},
+		{name: "xyz", ok: false},
+	}
+
+	for _, tc := range testCases {
+		got, ok := suggest(subcmds, tc.name)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("suggest(%q) = %q, %v; want %q, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestHelpSorted(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "zz"},
+			&testLeaf{name: "aa"},
+			&testLeaf{name: "mm"},
+		},
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	aa := strings.Index(stderr, "  aa ")
+	mm := strings.Index(stderr, "  mm ")
+	zz := strings.Index(stderr, "  zz ")
+	if !(aa < mm && mm < zz) {
+		t.Fatalf("subcommands are not sorted: %q", stderr)
+	}
+}
+
+type testPersistentBranch struct {
+	testBranch
+	persistentFlags func(f *flag.FlagSet)
+}
+
+func (b *testPersistentBranch) PersistentFlags(f *flag.FlagSet) {
+	b.persistentFlags(f)
+}
+
+func TestPersistentFlags(t *testing.T) {
+	var verbose bool
+	var long bool
+	var ran bool
+	root := &testPersistentBranch{
+		testBranch: testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testLeaf{
+					name: "ls",
+					flags: func(f *flag.FlagSet) {
+						f.BoolVar(&long, "l", false, "Use long format.")
+					},
+					run: func(ctx context.Context, args []string) int {
+						ran = true
+						return 0
+					},
+				},
+			},
+		},
+		persistentFlags: func(f *flag.FlagSet) {
+			f.BoolVar(&verbose, "verbose", false, "Enable verbose output.")
+		},
+	}
+
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{name: "before", args: []string{"-verbose", "ls", "-l"}},
+		{name: "after", args: []string{"ls", "-verbose", "-l"}},
+	}
+
+	for _, tc := range testCases {
+		verbose, long, ran = false, false, false
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != 0 || !ran {
+			t.Fatalf("%v: unexpected status %v: %q", tc.name, status, stderr)
+		}
+		if !verbose || !long {
+			t.Fatalf("%v: flags not set: verbose=%v long=%v", tc.name, verbose, long)
+		}
+	}
+}
+
+func TestPersistentFlagCollision(t *testing.T) {
+	root := &testPersistentBranch{
+		testBranch: testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testLeaf{
+					name: "ls",
+					flags: func(f *flag.FlagSet) {
+						f.Bool("verbose", false, "")
+					},
+				},
+			},
+		},
+		persistentFlags: func(f *flag.FlagSet) {
+			f.Bool("verbose", false, "")
+		},
+	}
+
+	defer func() {
+		err, ok := recover().(*RegistrationError)
+		if !ok || err.Command != "root ls" || err.Reason != "flag -verbose collides with a persistent flag" {
+			t.Fatalf("unexpected panic: %#v", err)
+		}
+	}()
+	runTest(t, root, "ls")
+}
+
+func TestSignalContext(t *testing.T) {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to find own process: %v", err)
+	}
+
+	ctx, cancel := SignalContext(context.Background())
+	defer cancel()
+
+	leaf := &testLeaf{
+		name: "sleep",
+		run: func(ctx context.Context, args []string) int {
+			err := p.Signal(os.Interrupt)
+			if err != nil {
+				t.Skipf("cannot send interrupt: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return 0
+			case <-time.After(time.Second * 10):
+				return 1
+			}
+		},
+	}
+
+	status := RunStatus(ctx, leaf, nil)
+	if status != 0 {
+		t.Fatalf("context was not cancelled by interrupt")
+	}
+}
+
+type testDefaultBranch struct {
+	testBranch
+	def string
+}
+
+func (b *testDefaultBranch) Default() string {
+	return b.def
+}
+
+func TestDefault(t *testing.T) {
+	var verbose bool
+	var ran string
+	root := &testDefaultBranch{
+		testBranch: testBranch{
+			name: "root",
+			flags: func(f *flag.FlagSet) {
+				f.BoolVar(&verbose, "verbose", false, "")
+			},
+			subcmds: []Command{
+				&testLeaf{
+					name: "status",
+					run: func(ctx context.Context, args []string) int {
+						ran = FullName(ctx)
+						return 0
+					},
+				},
+			},
+		},
+		def: "status",
+	}
+
+	status, _, _ := runTest(t, root, "-verbose")
+	if status != 0 {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	if ran != "root status" || !verbose {
+		t.Fatalf("default not run with flags: ran=%q verbose=%v", ran, verbose)
+	}
+}
+
+func TestDefaultCommandEnv(t *testing.T) {
+	const env = "CLI_TEST_DEFAULT_CMD"
+
+	var ran string
+	leaf := func(name string) Command {
+		return &testLeaf{
+			name: name,
+			run: func(ctx context.Context, args []string) int {
+				ran = FullName(ctx)
+				return 0
+			},
+		}
+	}
+	withDefault := &testDefaultBranch{
+		testBranch: testBranch{
+			name:    "root",
+			subcmds: []Command{leaf("status"), leaf("log")},
+		},
+		def: "status",
+	}
+	withoutDefault := &testBranch{
+		name:    "root",
+		subcmds: []Command{leaf("status"), leaf("log")},
+	}
+
+	c := &Config{DefaultCommandEnv: env}
+	defer os.Unsetenv(env)
+
+	testCases := []struct {
+		name   string
+		root   Command
+		env    string
+		args   []string
+		status int
+		ran    string
+	}{
+		{name: "arg", root: withDefault, env: "log", args: []string{"status"}, ran: "root status"},
+		{name: "env", root: withDefault, env: "log", ran: "root log"},
+		{name: "default", root: withDefault, ran: "root status"},
+		{name: "envWithoutDefault", root: withoutDefault, env: "log", ran: "root log"},
+		{name: "help", root: withoutDefault, status: 2},
+		{name: "unknown", root: withDefault, env: "nope", status: 2},
+	}
+
+	for _, tc := range testCases {
+		ran = ""
+		os.Setenv(env, tc.env)
+		status, _, _ := runTestConfig(t, c, tc.root, tc.args...)
+		if status != tc.status || ran != tc.ran {
+			t.Errorf("%v: unexpected status %v and ran %q", tc.name, status, ran)
+		}
+	}
+}
+
+func TestPrintTree(t *testing.T) {
+	var b bytes.Buffer
+	err := PrintTree(&b, testCompletionTree())
+	if err != nil {
+		t.Fatalf("failed to print tree: %v", err)
+	}
+
+	exp := `root          [flags...] <subcmd>    Test branch.
+  ls, list    [flags...]             Test leaf.
+  remote      [flags...] <subcmd>    Test branch.
+    add       [flags...]             Test leaf.
+`
+	if b.String() != exp {
+		t.Fatalf("unexpected tree:\n%v\nexpected:\n%v", b.String(), exp)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.Bool("l", false, "Use long format.")
+		},
+	}
+
+	testCases := []struct {
+		name   string
+		args   []string
+		status int
+		stderr string
+	}{
+		{name: "help", args: []string{"-h"}, status: 0, stderr: "Usage:\n\troot [flags...]"},
+		{name: "longHelp", args: []string{"--help"}, status: 0, stderr: "Usage:\n\troot [flags...]"},
+		{name: "helpAfterArgs", args: []string{"-l", "-help"}, status: 0, stderr: "Usage:\n\troot [flags...]"},
+		{name: "badFlag", args: []string{"-x"}, status: 2, stderr: "root: flag provided but not defined: -x\n\nUsage:"},
+	}
+
+	for _, tc := range testCases {
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != tc.status {
+			t.Errorf("%v: unexpected status %v; expected %v", tc.name, status, tc.status)
+		}
+		if !strings.HasPrefix(stderr, tc.stderr) {
+			t.Errorf("%v: unexpected stderr %q; expected prefix %q", tc.name, stderr, tc.stderr)
+		}
+	}
+}
+
+func TestCheckNArgs(t *testing.T) {
+	testCases := []struct {
+		n, min, max int
+		exp         string
+	}{
+		{n: 1, min: 1, max: 1},
+		{n: 0, min: 1, max: 1, exp: "expected 1 argument, got 0"},
+		{n: 0, min: 2, max: -1, exp: "expected at least 2 arguments, got 0"},
+		{n: 5, min: 2, max: -1},
+		{n: 3, min: 0, max: 2, exp: "expected at most 2 arguments, got 3"},
+	}
+
+	for _, tc := range testCases {
+		msg := NewConfig().checkNArgs(tc.n, tc.min, tc.max)
+		if msg != tc.exp {
+			t.Errorf("checkNArgs(%v, %v, %v) = %q; expected %q", tc.n, tc.min, tc.max, msg, tc.exp)
+		}
+	}
+}
+
+type hooksKey struct{}
+
+type testHooksBranch struct {
+	testBranch
+	before func(ctx context.Context) (context.Context, error)
+	after  func(ctx context.Context, status int)
+}
+
+func (b *testHooksBranch) Before(ctx context.Context) (context.Context, error) {
+	return b.before(ctx)
+}
+
+func (b *testHooksBranch) After(ctx context.Context, status int) {
+	b.after(ctx, status)
+}
+
+func TestHooks(t *testing.T) {
+	var beforeErr error
+	var events []string
+	root := &testHooksBranch{
+		testBranch: testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testLeaf{
+					name: "run",
+					run: func(ctx context.Context, args []string) int {
+						events = append(events, "run "+ctx.Value(hooksKey{}).(string))
+						return 3
+					},
+				},
+			},
+		},
+		before: func(ctx context.Context) (context.Context, error) {
+			events = append(events, "before")
+			return context.WithValue(ctx, hooksKey{}, "db"), beforeErr
+		},
+		after: func(ctx context.Context, status int) {
+			events = append(events, fmt.Sprintf("after %v", status))
+		},
+	}
+
+	status, _, _ := runTest(t, root, "run")
+	if status != 3 {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	if exp := []string{"before", "run db", "after 3"}; !reflect.DeepEqual(events, exp) {
+		t.Fatalf("unexpected events %q; expected %q", events, exp)
+	}
+
+	events = nil
+	beforeErr = errors.New("failed to connect")
+	status, _, stderr := runTest(t, root, "run")
+	if status != 1 || stderr != "root: failed to connect\n" {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+	if exp := []string{"before"}; !reflect.DeepEqual(events, exp) {
+		t.Fatalf("unexpected events %q; expected %q", events, exp)
+	}
+
+	events = nil
+	status, _, stderr = runTest(t, root, "run", "-help")
+	if status != 0 || len(events) > 0 || !strings.HasPrefix(stderr, "Usage:\n\troot run") {
+		t.Fatalf("unexpected status %v, events %q and stderr %q", status, events, stderr)
+	}
+}
+
+func TestSubcommandVersion(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	status, stdout, _ := runTest(t, root, "ls", "-version")
+	if status != 0 || stdout != Version+"\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, stdout)
+	}
+}
+
+func TestOwnVersionFlag(t *testing.T) {
+	var v string
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "install",
+				flags: func(f *flag.FlagSet) {
+					f.StringVar(&v, "version", "latest", "Version to install.")
+				},
+			},
+		},
+	}
+
+	status, stdout, _ := runTest(t, root, "install", "-version", "v1.0.0")
+	if status != 0 || stdout != "" || v != "v1.0.0" {
+		t.Fatalf("unexpected status %v, stdout %q and version %q", status, stdout, v)
+	}
+
+	status, stdout, _ = runTest(t, root, "-version")
+	if status != 0 || stdout != Version+"\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, stdout)
+	}
+}
+
+func TestVersionFunc(t *testing.T) {
+	c := &Config{
+		VersionFunc: func() string {
+			return "v1.2.3 (abc123)"
+		},
+	}
+
+	status, stdout, _ := runTestConfig(t, c, &testLeaf{name: "root"}, "-version")
+	if status != 0 || stdout != "v1.2.3 (abc123)\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, stdout)
+	}
+}
+
+func TestWithVersion(t *testing.T) {
+	testCases := []struct {
+		version string
+		commit  string
+		date    string
+		exp     string
+	}{
+		{version: "v1.2.3", commit: "abc123", date: "2024-01-01", exp: "v1.2.3 (abc123, 2024-01-01)"},
+		{version: "v1.2.3", date: "2024-01-01", exp: "v1.2.3 (2024-01-01)"},
+		{version: "v1.2.3", exp: "v1.2.3"},
+		{commit: "abc123", exp: Version + " (abc123)"},
+	}
+
+	for _, tc := range testCases {
+		got := WithVersion(tc.version, tc.commit, tc.date)()
+		if got != tc.exp {
+			t.Errorf("%q: unexpected version %q", tc.exp, got)
+		}
+	}
+
+	c := &Config{Version: "v2.0.0"}
+	status, stdout, _ := runTestConfig(t, c, &testLeaf{name: "root"}, "-version")
+	if status != 0 || stdout != "v2.0.0\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, stdout)
+	}
+
+	status, stdout, _ = runTest(t, &testLeaf{name: "root"}, "-version")
+	if status != 0 || stdout != Version+"\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, stdout)
+	}
+}
+
+func TestHelpFlag(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	testCases := []struct {
+		args []string
+		exp  string
+	}{
+		{args: []string{"--help"}, exp: "Usage:\n\troot [flags...] <subcmd>\n"},
+		{args: []string{"--help", "ls"}, exp: "Usage:\n\troot [flags...] <subcmd>\n"},
+		{args: []string{"ls", "--help"}, exp: "Usage:\n\troot ls [flags...]\n"},
+	}
+
+	for _, tc := range testCases {
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != 0 || !strings.HasPrefix(stderr, tc.exp) {
+			t.Errorf("%q: unexpected status %v and stderr %q", tc.args, status, stderr)
+		}
+	}
+}
+
+func TestHelpToStdout(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	c := &Config{HelpToStdout: true}
+
+	for _, args := range [][]string{{"-h"}, {"--help"}, {"ls", "-help"}} {
+		status, stdout, stderr := runTestConfig(t, c, root, args...)
+		if status != 0 || !strings.HasPrefix(stdout, "Usage:\n") || stderr != "" {
+			t.Errorf("%q: unexpected status %v, stdout %q and stderr %q", args, status, stdout, stderr)
+		}
+	}
+
+	for _, args := range [][]string{{"-x"}, {"unknown"}} {
+		status, stdout, stderr := runTestConfig(t, c, root, args...)
+		if status != 2 || stdout != "" || !strings.Contains(stderr, "Usage:\n") {
+			t.Errorf("%q: unexpected status %v, stdout %q and stderr %q", args, status, stdout, stderr)
+		}
+	}
+}
+
+type testHiddenLeaf struct {
+	testLeaf
+}
+
+func (l *testHiddenLeaf) Hidden() bool {
+	return true
+}
+
+func TestHidden(t *testing.T) {
+	var ran bool
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+			&testHiddenLeaf{
+				testLeaf: testLeaf{
+					name: "secret",
+					run: func(ctx context.Context, args []string) int {
+						ran = true
+						return 0
+					},
+				},
+			},
+		},
+	}
+
+	status, _, _ := runTest(t, root, "secret")
+	if status != 0 || !ran {
+		t.Fatalf("hidden command did not run: %v", status)
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	if strings.Contains(stderr, "secret") {
+		t.Fatalf("help lists hidden command: %q", stderr)
+	}
+	root.subcmds = root.subcmds[1:]
+	_, _, stderr = runTest(t, root, "-h")
+	if strings.Contains(stderr, "Subcommands:") {
+		t.Fatalf("help lists subcommands heading without visible subcommands: %q", stderr)
+	}
+}
+
+type testDeprecatedLeaf struct {
+	testLeaf
+}
+
+func (l *testDeprecatedLeaf) Deprecated() string {
+	return "use new instead"
+}
+
+func TestDeprecated(t *testing.T) {
+	var ran bool
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testDeprecatedLeaf{
+				testLeaf: testLeaf{
+					name: "old",
+					run: func(ctx context.Context, args []string) int {
+						ran = true
+						return 0
+					},
+				},
+			},
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "old")
+	if status != 0 || !ran {
+		t.Fatalf("deprecated command did not run: %v", status)
+	}
+	if stderr != "warning: \"root old\" is deprecated: use new instead\n" {
+		t.Fatalf("unexpected warning: %q", stderr)
+	}
+
+	_, _, stderr = runTest(t, root, "-h")
+	if !strings.Contains(stderr, "Test leaf. (deprecated)") {
+		t.Fatalf("help does not mark command deprecated: %q", stderr)
+	}
+}
+
+type testDeprecatedInfoLeaf struct {
+	testLeaf
+	d Deprecation
+}
+
+func (l *testDeprecatedInfoLeaf) DeprecatedInfo() Deprecation {
+	return l.d
+}
+
+func TestDeprecatedInfo(t *testing.T) {
+	testCases := []struct {
+		d       Deprecation
+		warning string
+		help    string
+	}{
+		{
+			d:       Deprecation{Message: "use new instead", RemovedIn: "v2.0"},
+			warning: "warning: \"root old\" is deprecated: use new instead (will be removed in v2.0)\n",
+			help:    "Test leaf. (deprecated, will be removed in v2.0)",
+		},
+		{
+			d:       Deprecation{RemovedIn: "v2.0"},
+			warning: "warning: \"root old\" is deprecated (will be removed in v2.0)\n",
+			help:    "Test leaf. (deprecated, will be removed in v2.0)",
+		},
+		{
+			d:       Deprecation{Message: "use new instead"},
+			warning: "warning: \"root old\" is deprecated: use new instead\n",
+			help:    "Test leaf. (deprecated)",
+		},
+		{
+			help: "Test leaf.\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		root := &testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testDeprecatedInfoLeaf{
+					testLeaf: testLeaf{name: "old"},
+					d:        tc.d,
+				},
+			},
+		}
+
+		_, _, stderr := runTest(t, root, "old")
+		if stderr != tc.warning {
+			t.Errorf("%+v: unexpected warning: %q", tc.d, stderr)
+		}
+
+		_, _, stderr = runTest(t, root, "-h")
+		if !strings.Contains(stderr, tc.help) {
+			t.Errorf("%+v: unexpected help: %q", tc.d, stderr)
+		}
+	}
+}
+
+func TestRoot(t *testing.T) {
+	var ran string
+	leaf := func(name string) Command {
+		return &testLeaf{
+			name: name,
+			run: func(ctx context.Context, args []string) int {
+				ran = FullName(ctx)
+				return 0
+			},
+		}
+	}
+	root := Root(leaf("ls"), leaf("cp"))
+
+	status, _, _ := runTest(t, root, "cp")
+	if status != 0 {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	if exp := filepath.Base(os.Args[0]) + " cp"; ran != exp {
+		t.Fatalf("unexpected fullname %q; expected %q", ran, exp)
+	}
+	defer func() {
+		err, ok := recover().(*RegistrationError)
+		if !ok || err.Reason != "no commands passed to Root" {
+			t.Fatalf("unexpected panic: %#v", err)
+		}
+	}()
+	Root()
+}
+
+func TestSubcommandParseError(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "ls", "-x")
+	exp := "root ls: flag provided but not defined: -x\n\nUsage:\n\troot ls [flags...]\n"
+	if status != 2 || !strings.HasPrefix(stderr, exp) {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+}
+
+type testGroupedLeaf struct {
+	testLeaf
+	group string
+}
+
+func (l *testGroupedLeaf) Group() string {
+	return l.group
+}
+
+func TestGroups(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testGroupedLeaf{testLeaf: testLeaf{name: "volume"}, group: "Management Commands"},
+			&testLeaf{name: "ls"},
+			&testGroupedLeaf{testLeaf: testLeaf{name: "ps"}, group: "Container Commands"},
+			&testGroupedLeaf{testLeaf: testLeaf{name: "image"}, group: "Management Commands"},
+		},
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	exp := `
+Subcommands:
+  ls    [flags...]    Test leaf.
+
+Container Commands:
+  ps    [flags...]    Test leaf.
+
+Management Commands:
+  image     [flags...]    Test leaf.
+  volume    [flags...]    Test leaf.
+`
+	if !strings.HasSuffix(stderr, exp) {
+		t.Fatalf("unexpected help %q; expected suffix %q", stderr, exp)
+	}
+}
+
+func TestShowVersionInHelp(t *testing.T) {
+	c := NewConfig()
+	c.ShowVersionInHelp = false
+
+	_, _, stderr := runTestConfig(t, c, &testLeaf{name: "root"}, "-h")
+	if strings.Contains(stderr, "Version:") {
+		t.Fatalf("help contains version: %q", stderr)
+	}
+}
+
+func TestSubcommandsLayout(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+			&testLeaf{name: "remove-everything", aliases: []string{"rm-all"}},
+		},
+	}
+
+	testCases := []struct {
+		width   int
+		padding int
+		exp     string
+	}{
+		{width: 80, exp: "\nSubcommands:\n  ls                           [flags...]    Test leaf.\n  remove-everything, rm-all    [flags...]    Test leaf.\n"},
+		{width: 76, exp: "\nSubcommands:\n  ls                         [flags...]  Test leaf.\n  remove-everything, rm-all  [flags...]  Test leaf.\n"},
+		{width: 80, padding: 1, exp: "\nSubcommands:\n  ls                        [flags...] Test leaf.\n  remove-everything, rm-all [flags...] Test leaf.\n"},
+		{width: 60, exp: "\nSubcommands:\n  ls [flags...]\n      Test leaf.\n  remove-everything, rm-all [flags...]\n      Test leaf.\n"},
+	}
+
+	for _, tc := range testCases {
+		c := &Config{HelpWidth: tc.width, HelpPadding: tc.padding}
+		_, _, stderr := runTestConfig(t, c, root, "-h")
+		if !strings.HasSuffix(stderr, tc.exp) {
+			t.Errorf("width %v and padding %v: unexpected help %q", tc.width, tc.padding, stderr)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	testCases := []struct {
+		s     string
+		width int
+		exp   string
+	}{
+		{s: "Lists a directory.", width: 80, exp: "Lists a directory."},
+		{s: "Lists a directory.", width: 10, exp: "Lists a\ndirectory."},
+		{s: "aaa bbb ccc\n\nddd eee", width: 7, exp: "aaa bbb\nccc\n\nddd eee"},
+		{s: "extraordinarily long", width: 5, exp: "extraordinarily\nlong"},
+		{s: "\tfoo bar", width: 7, exp: "\tfoo\n\tbar"},
+	}
+
+	for _, tc := range testCases {
+		got := wrap(tc.s, tc.width)
+		if got != tc.exp {
+			t.Errorf("wrap(%q, %v) = %q; expected %q", tc.s, tc.width, got, tc.exp)
+		}
+	}
+}
+
+func TestInterspersedFlags(t *testing.T) {
+	var long bool
+	var gotArgs []string
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.BoolVar(&long, "l", false, "")
+		},
+		run: func(ctx context.Context, args []string) int {
+			gotArgs = args
+			return 0
+		},
+	}
+
+	c := &Config{InterspersedFlags: true}
+
+	testCases := []struct {
+		args    []string
+		expLong bool
+		expArgs []string
+	}{
+		{args: []string{"a", "-l", "b"}, expLong: true, expArgs: []string{"a", "b"}},
+		{args: []string{"-l", "a", "b"}, expLong: true, expArgs: []string{"a", "b"}},
+		{args: []string{"a", "--", "-l", "b"}, expLong: false, expArgs: []string{"a", "-l", "b"}},
+		{args: []string{"a"}, expLong: false, expArgs: []string{"a"}},
+	}
+
+	for _, tc := range testCases {
+		long, gotArgs = false, nil
+		status, _, stderr := runTestConfig(t, c, root, tc.args...)
+		if status != 0 {
+			t.Fatalf("%q: unexpected status %v: %q", tc.args, status, stderr)
+		}
+		if long != tc.expLong || !reflect.DeepEqual(gotArgs, tc.expArgs) {
+			t.Errorf("%q: unexpected long %v and args %q", tc.args, long, gotArgs)
+		}
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "boom",
+				run: func(ctx context.Context, args []string) int {
+					panic("boom")
+				},
+			},
+		},
+	}
+
+	c := &Config{RecoverPanics: true}
+
+	status, _, stderr := runTestConfig(t, c, root, "boom")
+	if status != StatusPanic || stderr != "root boom: panic: boom\n" {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+}
+
+func TestFlagSet(t *testing.T) {
+	var set []string
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.Bool("a", false, "")
+			f.Bool("b", false, "")
+		},
+		run: func(ctx context.Context, args []string) int {
+			FlagSet(ctx).Visit(func(fl *flag.Flag) {
+				set = append(set, fl.Name)
+			})
+			return 0
+		},
+	}
+
+	runTest(t, root, "-b")
+	if !reflect.DeepEqual(set, []string{"b"}) {
+		t.Fatalf("unexpected set flags: %q", set)
+	}
+}
+
+func TestPrefixMatch(t *testing.T) {
+	var ran string
+	leaf := func(name string, aliases ...string) Command {
+		return &testLeaf{
+			name:    name,
+			aliases: aliases,
+			run: func(ctx context.Context, args []string) int {
+				ran = FullName(ctx)
+				return 0
+			},
+		}
+	}
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			leaf("install", "inst"),
+			leaf("info"),
+			leaf("in"),
+		},
+	}
+
+	c := &Config{AllowPrefixMatch: true}
+
+	testCases := []struct {
+		arg    string
+		status int
+		ran    string
+	}{
+		{arg: "ins", status: 0, ran: "root install"},
+		{arg: "inf", status: 0, ran: "root info"},
+		{arg: "in", status: 0, ran: "root in"},
+		{arg: "i", status: 2},
+	}
+
+	for _, tc := range testCases {
+		ran = ""
+		status, _, _ := runTestConfig(t, c, root, tc.arg)
+		if status != tc.status || ran != tc.ran {
+			t.Errorf("%q: unexpected status %v and ran %q", tc.arg, status, ran)
+		}
+	}
+}
+
+func TestFlagPrefix(t *testing.T) {
+	var (
+		verbose bool
+		output  string
+		gotArgs []string
+	)
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.BoolVar(&verbose, "verbose", false, "Verbose output.")
+			f.StringVar(&output, "output", "", "Output file.")
+		},
+		run: func(ctx context.Context, args []string) int {
+			gotArgs = args
+			return 0
+		},
+	}
+
+	c := &Config{AllowFlagPrefix: true}
+
+	testCases := []struct {
+		args    []string
+		status  int
+		verbose bool
+		output  string
+		exp     []string
+		stderr  string
+	}{
+		{args: []string{"-verbo"}, verbose: true, exp: []string{}},
+		{args: []string{"--out=x", "a"}, output: "x", exp: []string{"a"}},
+		{args: []string{"-o", "-verb"}, output: "-verb", exp: []string{}},
+		{args: []string{"a", "-verbo"}, exp: []string{"a", "-verbo"}},
+		{args: []string{"--", "-verbo"}, exp: []string{"-verbo"}},
+		{args: []string{"-ver"}, status: 2, stderr: "root: ambiguous flag -ver could be: -verbose, -version\n"},
+	}
+
+	for _, tc := range testCases {
+		verbose, output, gotArgs = false, "", nil
+		status, _, stderr := runTestConfig(t, c, root, tc.args...)
+		if status != tc.status || !strings.HasPrefix(stderr, tc.stderr) {
+			t.Errorf("%q: unexpected status %v and stderr %q", tc.args, status, stderr)
+		}
+		if verbose != tc.verbose || output != tc.output || !reflect.DeepEqual(gotArgs, tc.exp) {
+			t.Errorf("%q: unexpected verbose %v, output %q and args %q", tc.args, verbose, output, gotArgs)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	root := &testLeaf{
+		name: "root",
+		run: func(ctx context.Context, args []string) int {
+			<-ctx.Done()
+			return 0
+		},
+	}
+
+	c := &Config{Timeout: time.Millisecond}
+
+	status, _, stderr := runTestConfig(t, c, root)
+	if status != 124 || stderr != "root: command timed out after 1ms\n" {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var got string
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "ls",
+				run: func(ctx context.Context, args []string) int {
+					got = FullName(ctx) + " " + Usage(ctx)
+					return 0
+				},
+			},
+		},
+	}
+
+	runTest(t, root, "ls")
+	if got != "root ls [flags...]" {
+		t.Fatalf("unexpected usage: %q", got)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var dryRun bool
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "rm",
+				run: func(ctx context.Context, args []string) int {
+					dryRun = DryRun(ctx)
+					return 0
+				},
+			},
+		},
+	}
+
+	runTest(t, root, "rm")
+	if dryRun {
+		t.Fatalf("dry run enabled without flag")
+	}
+
+	c := &Config{DryRunFlag: true}
+
+	for _, args := range [][]string{{"-dry-run", "rm"}, {"rm", "-dry-run"}} {
+		dryRun = false
+		status, _, stderr := runTestConfig(t, c, root, args...)
+		if status != 0 || !dryRun {
+			t.Errorf("%q: unexpected status %v and dry run %v: %q", args, status, dryRun, stderr)
+		}
+	}
+}
+
+type testLeafE struct {
+	name  string
+	runE  func(ctx context.Context, args []string) error
+	nargs int
+}
+
+func (l *testLeafE) Name() string          { return l.name }
+func (l *testLeafE) Desc() string          { return "Test leaf." }
+func (l *testLeafE) Usage() string         { return "<arg>" }
+func (l *testLeafE) Flags(f *flag.FlagSet) {}
+func (l *testLeafE) NArgs() (min, max int) { return l.nargs, l.nargs }
+
+func (l *testLeafE) RunE(ctx context.Context, args []string) error {
+	return l.runE(ctx, args)
+}
+
+type testExitError struct {
+	code int
+}
+
+func (e testExitError) Error() string { return fmt.Sprintf("exit %v", e.code) }
+func (e testExitError) ExitCode() int { return e.code }
+
+type testWrapError struct {
+	err error
+}
+
+func (e testWrapError) Error() string { return "wrapped: " + e.err.Error() }
+func (e testWrapError) Unwrap() error { return e.err }
+
+func TestLeafE(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		status int
+		stderr string
+	}{
+		{name: "nil"},
+		{name: "error", err: errors.New("bad"), status: 1, stderr: "root e: bad\n"},
+		{name: "exitCode", err: testExitError{code: 3}, status: 3, stderr: "root e: exit 3\n"},
+		{name: "wrapped", err: testWrapError{testExitError{code: 4}}, status: 4, stderr: "root e: wrapped: exit 4\n"},
+	}
+
+	for _, tc := range testCases {
+		var gotArgs []string
+		root := &testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testLeafE{
+					name:  "e",
+					nargs: 1,
+					runE: func(ctx context.Context, args []string) error {
+						gotArgs = args
+						return tc.err
+					},
+				},
+			},
+		}
+
+		status, _, stderr := runTest(t, root, "e", "x")
+		if status != tc.status || stderr != tc.stderr {
+			t.Errorf("%v: unexpected status %v and stderr %q", tc.name, status, stderr)
+		}
+		if !reflect.DeepEqual(gotArgs, []string{"x"}) {
+			t.Errorf("%v: unexpected args %q", tc.name, gotArgs)
+		}
+
+		gotArgs = nil
+		status, _, _ = runTest(t, root, "e")
+		if status != 2 || gotArgs != nil {
+			t.Errorf("%v: unexpected status %v and args %q", tc.name, status, gotArgs)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	testCases := []struct {
+		script string
+		exp    int
+	}{
+		{script: "exit 0", exp: 0},
+		{script: "exit 3", exp: 3},
+		{script: "kill -TERM $$", exp: 128 + 15},
+	}
+
+	for _, tc := range testCases {
+		err := exec.Command("sh", "-c", tc.script).Run()
+		if code := ExitCode(err); code != tc.exp {
+			t.Errorf("%q: unexpected exit code %v; expected %v", tc.script, code, tc.exp)
+		}
+	}
+
+	if code := ExitCode(errors.New("failed to start")); code != 1 {
+		t.Errorf("unexpected exit code %v for non exit error", code)
+	}
+}
+
+func TestDoubleDash(t *testing.T) {
+	var gotArgs []string
+	var verbose bool
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "run",
+				flags: func(f *flag.FlagSet) {
+					f.BoolVar(&verbose, "v", false, "Verbose output.")
+				},
+				run: func(ctx context.Context, args []string) int {
+					gotArgs = args
+					return 0
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		args         []string
+		interspersed bool
+		exp          []string
+		verbose      bool
+	}{
+		{args: []string{"run", "--", "--weird-arg", "-v"}, exp: []string{"--weird-arg", "-v"}},
+		{args: []string{"run", "-v", "--", "-h", "--"}, exp: []string{"-h", "--"}, verbose: true},
+		{args: []string{"--", "run", "--", "-x"}, exp: []string{"-x"}},
+		{args: []string{"run", "a", "--", "-v"}, interspersed: true, exp: []string{"a", "-v"}},
+		{args: []string{"run", "a", "-v", "--", "-v", "b"}, interspersed: true, exp: []string{"a", "-v", "b"}, verbose: true},
+	}
+
+	for _, tc := range testCases {
+		gotArgs = nil
+
+		c := &Config{InterspersedFlags: tc.interspersed}
+		status, _, stderr := runTestConfig(t, c, root, tc.args...)
+		if status != 0 {
+			t.Fatalf("%q: unexpected status %v: %q", tc.args, status, stderr)
+		}
+		if !reflect.DeepEqual(gotArgs, tc.exp) || verbose != tc.verbose {
+			t.Errorf("%q: unexpected args %q and verbose %v", tc.args, gotArgs, verbose)
+		}
+	}
+}
+
+func TestProgramName(t *testing.T) {
+	var fullname string
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "ls",
+				run: func(ctx context.Context, args []string) int {
+					fullname = FullName(ctx)
+					return 0
+				},
+			},
+		},
+	}
+
+	c := &Config{ProgramName: "mytool"}
+
+	runTestConfig(t, c, root, "ls")
+	if fullname != "mytool ls" {
+		t.Fatalf("unexpected full name %q", fullname)
+	}
+
+	_, _, stderr := runTestConfig(t, c, root, "-h")
+	if !strings.HasPrefix(stderr, "Usage:\n\tmytool [flags...] <subcmd>") {
+		t.Fatalf("unexpected help %q", stderr)
+	}
+}
+
+func TestMultiCall(t *testing.T) {
+	var fullname string
+	var gotArgs []string
+	run := func(ctx context.Context, args []string) int {
+		fullname = FullName(ctx)
+		gotArgs = args
+		return 0
+	}
+	root := &testBranch{
+		name: "mytool",
+		subcmds: []Command{
+			&testLeaf{name: "ls", aliases: []string{"dir"}, run: run},
+			&testLeaf{name: "cp", run: run},
+		},
+	}
+
+	testCases := []struct {
+		argv0    string
+		args     []string
+		fullname string
+		exp      []string
+	}{
+		{argv0: "/usr/bin/ls", args: []string{"a"}, fullname: "mytool ls", exp: []string{"a"}},
+		{argv0: "dir.exe", args: []string{"a"}, fullname: "mytool ls", exp: []string{"a"}},
+		{argv0: "./mytool", args: []string{"cp", "a", "b"}, fullname: "mytool cp", exp: []string{"a", "b"}},
+	}
+
+	for _, tc := range testCases {
+		status, _, stderr := runTest(t, root, NewConfig().multiCallArgs(root, tc.argv0, tc.args)...)
+		if status != 0 {
+			t.Fatalf("%v: unexpected status %v: %q", tc.argv0, status, stderr)
+		}
+		if fullname != tc.fullname || !reflect.DeepEqual(gotArgs, tc.exp) {
+			t.Errorf("%v: unexpected full name %q and args %q", tc.argv0, fullname, gotArgs)
+		}
+	}
+}
+
+type testExampledLeaf struct {
+	testLeaf
+	examples []string
+}
+
+func (l *testExampledLeaf) Examples() []string {
+	return l.examples
+}
+
+func TestExamples(t *testing.T) {
+	leaf := &testExampledLeaf{
+		testLeaf: testLeaf{name: "ls"},
+		examples: []string{"root ls -l /tmp", "root ls ."},
+	}
+
+	_, _, stderr := runTest(t, leaf, "-h")
+	if !strings.Contains(stderr, "\nExamples:\n  root ls -l /tmp\n  root ls .\n\nFlags:") {
+		t.Fatalf("examples not in help: %q", stderr)
+	}
+
+	leaf.examples = nil
+	_, _, stderr = runTest(t, leaf, "-h")
+	if strings.Contains(stderr, "Examples:") {
+		t.Fatalf("empty examples in help: %q", stderr)
+	}
+}
+
+type testArgsLeaf struct {
+	testLeaf
+	args []ArgDef
+}
+
+func (l *testArgsLeaf) PositionalArgs() []ArgDef {
+	return l.args
+}
+
+func TestPositionalArgs(t *testing.T) {
+	leaf := &testArgsLeaf{
+		testLeaf: testLeaf{name: "cp"},
+		args: []ArgDef{
+			{Name: "<src>", Desc: "Source file."},
+			{Name: "<dest>", Desc: "Destination."},
+		},
+	}
+
+	_, _, stderr := runTest(t, leaf, "-h")
+	if !strings.HasPrefix(stderr, "Usage:\n\tcp [flags...] <src> <dest>\n") ||
+		!strings.Contains(stderr, "\nArguments:\n  <src>     Source file.\n  <dest>    Destination.\n\nFlags:") {
+		t.Fatalf("unexpected help: %q", stderr)
+	}
+
+	leaf.args = nil
+	_, _, stderr = runTest(t, leaf, "-h")
+	if strings.Contains(stderr, "Arguments:") {
+		t.Fatalf("empty arguments in help: %q", stderr)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	c := &Config{
+		Translate: func(s string) string {
+			switch s {
+			case "Usage:":
+				return "Utilisation :"
+			case "Subcommands:":
+				return "Sous-commandes :"
+			}
+			return s
+		},
+	}
+
+	_, _, stderr := runTestConfig(t, c, root, "-h")
+	for _, exp := range []string{"Utilisation :\n\troot", "\nSous-commandes :\n  ls"} {
+		if !strings.Contains(stderr, exp) {
+			t.Errorf("expected %q in help: %q", exp, stderr)
+		}
+	}
+}
+
+func TestMissingSubcommand(t *testing.T) {
+	var ran bool
+	root := &testBranch{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.Bool("verbose", false, "Verbose output.")
+		},
+		subcmds: []Command{
+			&testLeaf{
+				name: "ls",
+				run: func(ctx context.Context, args []string) int {
+					ran = true
+					return 0
+				},
+			},
+		},
+	}
+
+	for _, args := range [][]string{nil, {"-verbose"}, {"--verbose", "--"}} {
+		status, _, stderr := runTest(t, root, args...)
+		if status != 2 || ran {
+			t.Fatalf("%q: unexpected status %v", args, status)
+		}
+		if !strings.HasPrefix(stderr, "root: please provide a subcommand\n\nUsage:") {
+			t.Errorf("%q: unexpected stderr %q", args, stderr)
+		}
+	}
+}
+
+func TestUnknownSubcommand(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "install")
+	if status != 2 || !strings.HasPrefix(stderr, "root: unknown subcommand: \"install\"\n\nUsage:\n\troot [flags...] <subcmd>\n") {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+}
+
+type testHybridBranch struct {
+	testBranch
+	run func(ctx context.Context, args []string) int
+}
+
+func (b *testHybridBranch) Usage() string { return "[args...]" }
+
+func (b *testHybridBranch) Run(ctx context.Context, args []string) int {
+	return b.run(ctx, args)
+}
+
+func TestHybridBranch(t *testing.T) {
+	var ran string
+	var gotArgs []string
+	root := &testHybridBranch{
+		testBranch: testBranch{
+			name: "stash",
+			subcmds: []Command{
+				&testLeaf{
+					name: "pop",
+					run: func(ctx context.Context, args []string) int {
+						ran = FullName(ctx)
+						gotArgs = args
+						return 0
+					},
+				},
+			},
+		},
+		run: func(ctx context.Context, args []string) int {
+			ran = FullName(ctx)
+			gotArgs = args
+			return 3
+		},
+	}
+
+	testCases := []struct {
+		args   []string
+		status int
+		ran    string
+		exp    []string
+	}{
+		{status: 3, ran: "stash"},
+		{args: []string{"list", "-x"}, status: 3, ran: "stash", exp: []string{"list", "-x"}},
+		{args: []string{"pop", "a"}, ran: "stash pop", exp: []string{"a"}},
+	}
+
+	for _, tc := range testCases {
+		ran, gotArgs = "", nil
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != tc.status {
+			t.Fatalf("%q: unexpected status %v: %q", tc.args, status, stderr)
+		}
+		if ran != tc.ran || !reflect.DeepEqual(gotArgs, tc.exp) {
+			t.Errorf("%q: unexpected command %q and args %q", tc.args, ran, gotArgs)
+		}
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	if !strings.HasPrefix(stderr, "Usage:\n\tstash [flags...] [<subcmd>] [args...]") {
+		t.Fatalf("unexpected help %q", stderr)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "ls",
+				run: func(ctx context.Context, args []string) int {
+					Logger(ctx).Printf("failed to list %q", args[0])
+					return 1
+				},
+			},
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "ls", "/tmp")
+	if status != 1 || stderr != "root ls: failed to list \"/tmp\"\n" {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	var b bytes.Buffer
+	c := &Config{
+		Middleware: []func(next RunFunc) RunFunc{
+			func(next RunFunc) RunFunc {
+				return func(ctx context.Context, args []string) int {
+					ctx = WithStdio(ctx, Stdin(ctx), Stdout(ctx), &b)
+					return next(ctx, args)
+				}
+			},
+		},
+	}
+	_, _, stderr = runTestConfig(t, c, root, "ls", "/tmp")
+	if stderr != "" || b.String() != "root ls: failed to list \"/tmp\"\n" {
+		t.Fatalf("logger ignored WithStdio: stderr %q and redirected %q", stderr, b.String())
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	var traceID string
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "ls",
+				run: func(ctx context.Context, args []string) int {
+					traceID = TraceID(ctx)
+					Logger(ctx).Print("listing")
+					return 0
+				},
+			},
+		},
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	_, _, stderr := runTest(t, root, "ls")
+	if !uuid.MatchString(traceID) || stderr != "root ls: listing\n" {
+		t.Fatalf("unexpected trace ID %q and stderr %q", traceID, stderr)
+	}
+	prev := traceID
+	runTest(t, root, "ls")
+	if traceID == prev {
+		t.Fatalf("trace ID %q reused", traceID)
+	}
+
+	c := &Config{TraceIDFlag: true}
+
+	_, _, stderr = runTestConfig(t, c, root, "-trace-id", "abc", "ls")
+	if traceID != "abc" || stderr != "root ls [abc]: listing\n" {
+		t.Fatalf("unexpected trace ID %q and stderr %q", traceID, stderr)
+	}
+	_, _, stderr = runTestConfig(t, c, root, "ls")
+	if !uuid.MatchString(traceID) || stderr != "root ls ["+traceID+"]: listing\n" {
+		t.Fatalf("unexpected trace ID %q and stderr %q", traceID, stderr)
+	}
+}
+
+func TestStdio(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "cat",
+				run: func(ctx context.Context, args []string) int {
+					_, err := io.Copy(Stdout(ctx), Stdin(ctx))
+					if err != nil {
+						fmt.Fprintln(Stderr(ctx), err)
+						return 1
+					}
+					fmt.Fprintln(Stderr(ctx), "done")
+					return 0
+				},
+			},
+		},
+	}
+
+	c := &Config{Stdin: strings.NewReader("meow\n")}
+
+	status, stdout, stderr := runTestConfig(t, c, root, "cat")
+	if status != 0 || stdout != "meow\n" || stderr != "done\n" {
+		t.Fatalf("unexpected status %v, stdout %q and stderr %q", status, stdout, stderr)
+	}
+
+	var out bytes.Buffer
+	ctx := WithStdio(context.Background(), strings.NewReader("woof\n"), &out, ioutil.Discard)
+	status = c.RunStatus(ctx, root, []string{"cat"})
+	if status != 0 || out.String() != "woof\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, out.String())
+	}
+}
+
+func TestTrimFlagsUsage(t *testing.T) {
+	testCases := []struct {
+		usage string
+		exp   string
+	}{
+		{usage: "<dir>", exp: "<dir>"},
+		{usage: "[flags] <dir>", exp: "<dir>"},
+		{usage: "[flags...] <dir>", exp: "<dir>"},
+		{usage: "[flags]", exp: ""},
+		{usage: "[flagship]", exp: "[flagship]"},
+	}
+
+	for _, tc := range testCases {
+		if got := trimFlagsUsage(tc.usage); got != tc.exp {
+			t.Errorf("trimFlagsUsage(%q) = %q; expected %q", tc.usage, got, tc.exp)
+		}
+	}
+}
+
+func TestRootLeaf(t *testing.T) {
+	var gotArgs []string
+	var long bool
+	root := &testLeaf{
+		name: "tool",
+		flags: func(f *flag.FlagSet) {
+			f.BoolVar(&long, "l", false, "Use long format.")
+		},
+		run: func(ctx context.Context, args []string) int {
+			if FullName(ctx) != "tool" {
+				t.Errorf("unexpected full name %q", FullName(ctx))
+			}
+			gotArgs = args
+			return 0
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "-l", "a", "b")
+	if status != 0 {
+		t.Fatalf("unexpected status %v: %q", status, stderr)
+	}
+	if !long || !reflect.DeepEqual(gotArgs, []string{"a", "b"}) {
+		t.Fatalf("unexpected long %v and args %q", long, gotArgs)
+	}
+
+	status, _, stderr = runTest(t, root, "-h")
+	if status != 0 || !strings.HasPrefix(stderr, "Usage:\n\ttool [flags...]\n") || strings.Contains(stderr, "Subcommands:") {
+		t.Fatalf("unexpected status %v and help %q", status, stderr)
+	}
+}
+
+func TestUsageFlags(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	for _, exp := range []string{"Usage:\n\troot [flags...] <subcmd>\n", "\n  ls    [flags...]    Test leaf.\n"} {
+		if !strings.Contains(stderr, exp) {
+			t.Errorf("expected %q in help: %q", exp, stderr)
+		}
+	}
+}
+
+func TestExternalSubcommands(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := "#!/bin/sh\necho \"$@\"\nexit 3\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "root-hello"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "root-cat"), []byte("#!/bin/sh\ncat\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(filepath.ListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	c := &Config{ExternalSubcommands: true}
+
+	status, stdout, stderr := runTestConfig(t, c, root, "hello", "-x", "world")
+	if status != 3 || stdout != "-x world\n" {
+		t.Fatalf("unexpected status %v, stdout %q and stderr %q", status, stdout, stderr)
+	}
+
+	status, _, _ = runTestConfig(t, c, root, "goodbye")
+	if status != 2 {
+		t.Fatalf("unexpected status %v for missing external subcommand", status)
+	}
+
+	var out bytes.Buffer
+	ctx := WithStdio(context.Background(), strings.NewReader("piped\n"), &out, ioutil.Discard)
+	status = c.RunStatus(ctx, root, []string{"cat"})
+	if status != 0 || out.String() != "piped\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, out.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "ls",
+				run: func(ctx context.Context, args []string) int {
+					calls = append(calls, "ls "+strings.Join(args, " "))
+					return 5
+				},
+			},
+		},
+	}
+
+	c := &Config{
+		Middleware: []func(RunFunc) RunFunc{
+			func(next RunFunc) RunFunc {
+				return func(ctx context.Context, args []string) int {
+					calls = append(calls, "outer "+FullName(ctx))
+					return next(ctx, args) + 1
+				}
+			},
+			func(next RunFunc) RunFunc {
+				return func(ctx context.Context, args []string) int {
+					calls = append(calls, "inner")
+					return next(ctx, append(args, "-extra"))
+				}
+			},
+		},
+	}
+
+	status, _, _ := runTestConfig(t, c, root, "ls", "a")
+	if status != 6 {
+		t.Fatalf("unexpected status %v", status)
+	}
+	exp := []string{"outer root ls", "inner", "ls a -extra"}
+	if !reflect.DeepEqual(calls, exp) {
+		t.Fatalf("unexpected calls %q; expected %q", calls, exp)
+	}
+}
+
+func TestFlagsCalledOnce(t *testing.T) {
+	calls := make(map[string]int)
+	leaf := func(name string) Command {
+		return &testLeaf{
+			name: name,
+			flags: func(f *flag.FlagSet) {
+				calls[name]++
+				f.Bool("l", false, "")
+			},
+		}
+	}
+	root := &testBranch{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			calls["root"]++
+		},
+		subcmds: []Command{leaf("ls"), leaf("cp")},
+	}
+
+	for _, args := range [][]string{{"-h"}, {"-help=json"}, {"ls", "-help=json"}, {"cp"}} {
+		for k := range calls {
+			delete(calls, k)
+		}
+		runTest(t, root, args...)
+		for name, n := range calls {
+			if n != 1 {
+				t.Errorf("%q: Flags of %v called %v times", args, name, n)
+			}
+		}
+	}
+}
+
+func TestPersistentFlagsCalledOnce(t *testing.T) {
+	var calls int
+	root := &testPersistentBranch{
+		testBranch: testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testLeaf{name: "ls"},
+			},
+		},
+		persistentFlags: func(f *flag.FlagSet) {
+			calls++
+			f.Bool("verbose", false, "Verbose output.")
+		},
+	}
+
+	for _, args := range [][]string{{"-h"}, {"-verbose", "-help=json"}, {"ls", "-h"}} {
+		calls = 0
+		status, stdout, stderr := runTest(t, root, args...)
+		if status != 0 || calls != 1 {
+			t.Errorf("%q: PersistentFlags called %v times: %q", args, calls, stderr)
+		}
+		if strings.Contains(stdout, `"default": "true"`) {
+			t.Errorf("%q: parsed value described as the default: %q", args, stdout)
+		}
+	}
+}
+
+type testValidatorBranch struct {
+	testBranch
+	validate func(ctx context.Context) error
+}
+
+func (b *testValidatorBranch) Validate(ctx context.Context) error {
+	return b.validate(ctx)
+}
+
+func TestValidate(t *testing.T) {
+	var ran bool
+	var validateErr error
+	root := &testValidatorBranch{
+		testBranch: testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testLeaf{
+					name: "ls",
+					run: func(ctx context.Context, args []string) int {
+						ran = true
+						return 0
+					},
+				},
+			},
+		},
+		validate: func(ctx context.Context) error {
+			return validateErr
+		},
+	}
+
+	status, _, _ := runTest(t, root, "ls")
+	if status != 0 || !ran {
+		t.Fatalf("unexpected status %v and ran %v", status, ran)
+	}
+
+	ran = false
+	validateErr = errors.New("$TOKEN is not set")
+	status, _, stderr := runTest(t, root, "ls")
+	if status != 1 || ran || stderr != "root: $TOKEN is not set\n" {
+		t.Fatalf("unexpected status %v, ran %v and stderr %q", status, ran, stderr)
+	}
+
+	for _, args := range [][]string{{"ls", "-help"}, {"ls", "-version"}} {
+		status, _, stderr = runTest(t, root, args...)
+		if status != 0 || ran || strings.Contains(stderr, "$TOKEN") {
+			t.Errorf("%q: unexpected status %v, ran %v and stderr %q", args, status, ran, stderr)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ls := &testLeaf{name: "ls", aliases: []string{"list"}, flags: func(f *flag.FlagSet) {
+		f.Bool("l", false, "")
+	}}
+	add := &testLeaf{name: "add"}
+	remote := &testBranch{name: "remote", subcmds: []Command{add}}
+	root := &testBranch{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.String("config", "", "")
+		},
+		subcmds: []Command{ls, remote},
+	}
+
+	testCases := []struct {
+		args []string
+		cmd  Command
+		rest []string
+		err  string
+	}{
+		{cmd: root},
+		{args: []string{"-config", "x", "list", "-l", "/tmp"}, cmd: ls, rest: []string{"-l", "/tmp"}},
+		{args: []string{"remote", "add", "origin"}, cmd: add, rest: []string{"origin"}},
+		{args: []string{"--", "remote", "-x"}, cmd: remote, rest: []string{"-x"}},
+		{args: []string{"remote", "rm"}, err: `root remote: unknown subcommand: "rm"`},
+	}
+
+	for _, tc := range testCases {
+		cmd, rest, err := Resolve(root, tc.args)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: unexpected error %v", tc.args, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tc.args, err)
+		}
+		if cmd != tc.cmd || !reflect.DeepEqual(rest, tc.rest) {
+			t.Errorf("%q: resolved %v with %q", tc.args, cmd.Name(), rest)
+		}
+	}
+}
+
+func TestArgFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	inner := write("inner", "c\n'd e'\n")
+	outer := write("outer", "ls\n-l a\n@"+inner+"\n")
+	loop := write("loop", "")
+	write("loop", "@"+loop)
+
+	var gotArgs []string
+	var long bool
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "ls",
+				flags: func(f *flag.FlagSet) {
+					f.BoolVar(&long, "l", false, "")
+				},
+				run: func(ctx context.Context, args []string) int {
+					gotArgs = args
+					return 0
+				},
+			},
+		},
+	}
+
+	c := &Config{ArgFiles: true}
+
+	status, _, stderr := runTestConfig(t, c, root, "@"+outer, "@@x", "--", "@y")
+	if status != 0 {
+		t.Fatalf("unexpected status %v: %q", status, stderr)
+	}
+	if exp := []string{"a", "c", "d e", "@x", "--", "@y"}; !long || !reflect.DeepEqual(gotArgs, exp) {
+		t.Fatalf("unexpected long %v and args %q; expected %q", long, gotArgs, exp)
+	}
+
+	status, _, stderr = runTestConfig(t, c, root, "@"+filepath.Join(dir, "missing"))
+	if status != 1 || !strings.HasPrefix(stderr, "root: failed to read argument file: ") {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	status, _, stderr = runTestConfig(t, c, root, "@"+loop)
+	if status != 1 || !strings.Contains(stderr, "includes itself") {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	var token string
+	tokenLeaf := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			FileOrStringVar(f, &token, "token", "", "")
+		},
+	}
+	secret := write("secret", "hunter2\n")
+	testCases := []struct {
+		args []string
+		exp  string
+	}{
+		{args: []string{"-token=@" + secret}, exp: "hunter2"},
+		{args: []string{"-token", "@" + write("tokenargs", "s3cret")}, exp: "s3cret"},
+		{args: []string{"-token", "@@@x"}, exp: "@x"},
+	}
+	for _, tc := range testCases {
+		token = ""
+		status, _, stderr = runTestConfig(t, c, tokenLeaf, tc.args...)
+		if status != 0 || token != tc.exp {
+			t.Errorf("%q: unexpected status %v, token %q and stderr %q", tc.args, status, token, stderr)
+		}
+	}
+}
+
+func TestFlagErrorHandling(t *testing.T) {
+	root := &testLeaf{name: "root"}
+
+	c := &Config{SilenceFlagErrors: true}
+	status, _, stderr := runTestConfig(t, c, root, "-x")
+	if status != 2 || stderr != "" {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	c = &Config{FlagErrorHandling: flag.PanicOnError}
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || err.Error() != "flag provided but not defined: -x" {
+			t.Fatalf("unexpected panic %#v", r)
+		}
+	}()
+	runTestConfig(t, c, root, "-x")
+}
@@ -0,0 +1,31 @@
+// Package clitest provides helpers for testing CLIs built with
+// nhooyr.io/cli.
+package clitest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"nhooyr.io/cli"
+)
+
+// Run runs cmd with args and returns the status along with
+// everything written to cli.Config.Stdout and cli.Config.Stderr.
+func Run(tb testing.TB, cmd cli.Command, args ...string) (status int, stdout, stderr string) {
+	tb.Helper()
+	return RunConfig(tb, cli.NewConfig(), cmd, args...)
+}
+
+// RunConfig is like Run but runs cmd with the settings in c.
+// c is not modified.
+func RunConfig(tb testing.TB, c *cli.Config, cmd cli.Command, args ...string) (status int, stdout, stderr string) {
+	tb.Helper()
+
+	var outb, errb bytes.Buffer
+	c2 := *c
+	c2.Stdout, c2.Stderr = &outb, &errb
+
+	status = c2.RunStatus(context.Background(), cmd, args)
+	return status, outb.String(), errb.String()
+}
@@ -0,0 +1,92 @@
+package clitest_test
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"nhooyr.io/cli"
+	"nhooyr.io/cli/clitest"
+)
+
+type greetCmd struct {
+	name     string
+	greeting string
+}
+
+var _ cli.ArgCount = &greetCmd{}
+
+func (greetCmd *greetCmd) Name() string {
+	return "greet"
+}
+
+func (greetCmd *greetCmd) Desc() string {
+	return "Prints a greeting."
+}
+
+func (greetCmd *greetCmd) Usage() string {
+	return ""
+}
+
+func (greetCmd *greetCmd) NArgs() (min, max int) {
+	return 0, 0
+}
+
+func (greetCmd *greetCmd) Flags(f *flag.FlagSet) {
+	f.StringVar(&greetCmd.name, "name", "world", "Who to greet.")
+}
+
+func (greetCmd *greetCmd) Run(ctx context.Context, args []string) int {
+	greetCmd.greeting = "hello " + greetCmd.name
+	return 0
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		status   int
+		greeting string
+		stdout   string
+		stderr   string
+	}{
+		{name: "default", status: 0, greeting: "hello world"},
+		{name: "flag", args: []string{"-name", "gopher"}, status: 0, greeting: "hello gopher"},
+		{name: "version", args: []string{"-version"}, status: 0, stdout: "<dev>\n"},
+		{name: "help", args: []string{"-h"}, status: 0, stderr: "Usage:\n\tgreet [flags...]\n"},
+		{name: "extraArgs", args: []string{"extra"}, status: 2, stderr: "Usage:\n\tgreet [flags...]\n"},
+	}
+
+	for _, tc := range testCases {
+		cmd := &greetCmd{}
+		status, stdout, stderr := clitest.Run(t, cmd, tc.args...)
+		if status != tc.status {
+			t.Errorf("%v: unexpected status %v; expected %v", tc.name, status, tc.status)
+		}
+		if cmd.greeting != tc.greeting {
+			t.Errorf("%v: unexpected greeting %q; expected %q", tc.name, cmd.greeting, tc.greeting)
+		}
+		if stdout != tc.stdout {
+			t.Errorf("%v: unexpected stdout %q; expected %q", tc.name, stdout, tc.stdout)
+		}
+		if !strings.Contains(stderr, tc.stderr) {
+			t.Errorf("%v: unexpected stderr %q; expected it to contain %q", tc.name, stderr, tc.stderr)
+		}
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	c := &cli.Config{
+		VersionFunc: func() string {
+			return "v1.2.3"
+		},
+	}
+	status, stdout, _ := clitest.RunConfig(t, c, &greetCmd{}, "-version")
+	if status != 0 || stdout != "v1.2.3\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, stdout)
+	}
+	if c.Stdout != nil || c.Stderr != nil {
+		t.Fatalf("RunConfig modified the passed Config")
+	}
+}
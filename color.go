@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"io"
+	"os"
+)
+
+// ColorMode controls whether help is colorized.
+type ColorMode int
+
+// The color modes.
+const (
+	// ColorAuto colorizes help when it is written to a terminal
+	// and the NO_COLOR environment variable is not set.
+	ColorAuto ColorMode = iota
+	// ColorAlways colorizes help unless the NO_COLOR
+	// environment variable is set.
+	ColorAlways
+	// ColorNever never colorizes help.
+	ColorNever
+)
+
+// String returns the name of the mode as accepted by ShouldColor.
+func (m ColorMode) String() string {
+	switch m {
+	case ColorAlways:
+		return "always"
+	case ColorNever:
+		return "never"
+	default:
+		return "auto"
+	}
+}
+
+// ShouldColor reports whether output should be colorized given the
+// forced mode, one of "always", "never" or "auto", and whether the
+// output is a terminal. An empty mode is treated as "auto".
+// The precedence is: "never" beats the NO_COLOR environment variable
+// which beats "always" which beats detecting a terminal.
+func ShouldColor(forced string, isTTY bool) bool {
+	if forced == "never" {
+		return false
+	}
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
+		return false
+	}
+	if forced == "always" {
+		return true
+	}
+	return isTTY
+}
+
+// useColor reports whether help written to w should be colorized.
+func (c *Config) useColor(w io.Writer) bool {
+	return ShouldColor(c.Color.String(), isTerminal(w))
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ANSI escape codes used in help.
+const (
+	ansiBold  = "\x1b[1m"
+	ansiCyan  = "\x1b[36m"
+	ansiReset = "\x1b[0m"
+)
+
+// colorizer wraps strings in ANSI escape codes when enabled.
+type colorizer bool
+
+func (c colorizer) wrap(code, s string) string {
+	if !c {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// header colorizes a section header in help.
+func (c colorizer) header(s string) string {
+	return c.wrap(ansiBold, s)
+}
+
+// name colorizes a command name in help.
+func (c colorizer) name(s string) string {
+	return c.wrap(ansiCyan, s)
+}
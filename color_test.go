@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestColor(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	_, _, plain := runTest(t, root, "-h")
+	if strings.Contains(plain, "\x1b[") {
+		t.Fatalf("help written to a buffer is colorized: %q", plain)
+	}
+
+	c := &Config{Color: ColorAlways}
+
+	_, _, colored := runTestConfig(t, c, root, "-h")
+	for _, exp := range []string{"\x1b[1mUsage:\x1b[0m", "\x1b[1mSubcommands:\x1b[0m", "\x1b[36mls\x1b[0m"} {
+		if !strings.Contains(colored, exp) {
+			t.Errorf("colorized help does not contain %q: %q", exp, colored)
+		}
+	}
+}
+
+func TestShouldColor(t *testing.T) {
+	testCases := []struct {
+		forced  string
+		isTTY   bool
+		noColor bool
+		exp     bool
+	}{
+		{forced: "", isTTY: true, exp: true},
+		{forced: "auto", isTTY: false, exp: false},
+		{forced: "auto", isTTY: true, noColor: true, exp: false},
+		{forced: "always", isTTY: false, exp: true},
+		{forced: "always", isTTY: true, noColor: true, exp: false},
+		{forced: "never", isTTY: true, exp: false},
+	}
+
+	defer os.Unsetenv("NO_COLOR")
+	for _, tc := range testCases {
+		os.Unsetenv("NO_COLOR")
+		if tc.noColor {
+			os.Setenv("NO_COLOR", "")
+		}
+
+		if got := ShouldColor(tc.forced, tc.isTTY); got != tc.exp {
+			t.Errorf("%q, tty %v, NO_COLOR %v: got %v; expected %v", tc.forced, tc.isTTY, tc.noColor, got, tc.exp)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// BashCompletion writes a bash completion script for cmd to w.
+// The script completes the subcommands and flags of every command
+// in the tree. It can be loaded with:
+//
+//	source <(examplecli completion bash)
+func BashCompletion(w io.Writer, cmd Command) error {
+	return NewConfig().BashCompletion(w, cmd)
+}
+
+// BashCompletion is like the package level BashCompletion
+// but with the settings in c.
+func (c *Config) BashCompletion(w io.Writer, cmd Command) error {
+	bw := bufio.NewWriter(w)
+
+	funcName := shellFuncName(c.rootName(cmd))
+
+	fmt.Fprintf(bw, "%v() {\n", funcName)
+	fmt.Fprintf(bw, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(bw, "\tlocal path=%v\n", shellQuote(c.rootName(cmd)))
+	fmt.Fprintf(bw, "\tlocal i\n")
+	fmt.Fprintf(bw, "\tfor ((i = 1; i < COMP_CWORD; i++)); do\n")
+	fmt.Fprintf(bw, "\t\tcase \"$path ${COMP_WORDS[i]}\" in\n")
+	c.walk(cmd, func(fullname string, cmd Command, f *flag.FlagSet) {
+		cmdb, ok := cmd.(Branch)
+		if !ok {
+			return
+		}
+		for _, subcmd := range visibleSubcommands(cmdb) {
+			var patterns []string
+			for _, name := range names(subcmd) {
+				patterns = append(patterns, shellQuote(fullname+" "+name))
+			}
+			fmt.Fprintf(bw, "\t\t%v)\n", strings.Join(patterns, " | "))
+			fmt.Fprintf(bw, "\t\t\tpath=%v\n", shellQuote(fullname+" "+subcmd.Name()))
+			fmt.Fprintf(bw, "\t\t\t;;\n")
+		}
+	})
+	fmt.Fprintf(bw, "\t\tesac\n")
+	fmt.Fprintf(bw, "\tdone\n\n")
+
+	fmt.Fprintf(bw, "\tcase \"$path\" in\n")
+	c.walk(cmd, func(fullname string, cmd Command, f *flag.FlagSet) {
+		var words []string
+		if cmd, ok := cmd.(Branch); ok {
+			for _, subcmd := range visibleSubcommands(cmd) {
+				words = append(words, names(subcmd)...)
+			}
+		}
+		f.VisitAll(func(fl *flag.Flag) {
+			if !isHiddenFlag(fl) {
+				words = append(words, "-"+fl.Name)
+			}
+		})
+
+		fmt.Fprintf(bw, "\t%v)\n", shellQuote(fullname))
+		var values bytes.Buffer
+		f.VisitAll(func(fl *flag.Flag) {
+			allowed := allowedValues(fl)
+			if isHiddenFlag(fl) || len(allowed) == 0 {
+				return
+			}
+			fmt.Fprintf(&values, "\t\t%v | %v)\n", shellQuote("-"+fl.Name), shellQuote("--"+fl.Name))
+			fmt.Fprintf(&values, "\t\t\tCOMPREPLY=($(compgen -W %v -- \"$cur\"))\n", shellQuote(strings.Join(allowed, " ")))
+			fmt.Fprintf(&values, "\t\t\treturn\n")
+			fmt.Fprintf(&values, "\t\t\t;;\n")
+		})
+		if values.Len() > 0 {
+			fmt.Fprintf(bw, "\t\tcase \"${COMP_WORDS[COMP_CWORD-1]}\" in\n")
+			bw.Write(values.Bytes())
+			fmt.Fprintf(bw, "\t\tesac\n")
+		}
+		fmt.Fprintf(bw, "\t\tCOMPREPLY=($(compgen -W %v -- \"$cur\"))\n", shellQuote(strings.Join(words, " ")))
+		if _, ok := cmd.(Completer); ok {
+			fmt.Fprintf(bw, "\t\tif [[ $cur != -* ]]; then\n")
+			fmt.Fprintf(bw, "\t\t\tlocal IFS=$'\\n'\n")
+			fmt.Fprintf(bw, "\t\t\tCOMPREPLY+=($(\"${COMP_WORDS[0]}\" %v \"${COMP_WORDS[@]:1:COMP_CWORD-1}\" \"$cur\" 2> /dev/null))\n", completeCmd)
+			fmt.Fprintf(bw, "\t\tfi\n")
+		}
+		fmt.Fprintf(bw, "\t\t;;\n")
+	})
+	fmt.Fprintf(bw, "\tesac\n")
+	fmt.Fprintf(bw, "}\n\n")
+
+	fmt.Fprintf(bw, "complete -F %v %v\n", funcName, shellQuote(c.rootName(cmd)))
+
+	return bw.Flush()
+}
+
+// ZshCompletion writes a zsh completion script for cmd to w.
+// The script completes the subcommands and flags of every command
+// in the tree along with their descriptions. It can be placed
+// in a directory in $fpath as _examplecli or loaded with:
+//
+//	source <(examplecli completion zsh)
+func ZshCompletion(w io.Writer, cmd Command) error {
+	return NewConfig().ZshCompletion(w, cmd)
+}
+
+// ZshCompletion is like the package level ZshCompletion
+// but with the settings in c.
+func (c *Config) ZshCompletion(w io.Writer, cmd Command) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "#compdef %v\n", c.rootName(cmd))
+
+	c.walk(cmd, func(fullname string, cmd Command, f *flag.FlagSet) {
+		fmt.Fprintf(bw, "\n%v() {\n", shellFuncName(fullname))
+
+		var specs []string
+		f.VisitAll(func(fl *flag.Flag) {
+			if isHiddenFlag(fl) {
+				return
+			}
+			spec := "-" + fl.Name + "[" + zshEscape(fl.Usage) + "]"
+			if allowed := allowedValues(fl); len(allowed) > 0 {
+				spec += ":" + fl.Name + ":(" + strings.Join(allowed, " ") + ")"
+			} else if !isBoolFlag(fl) {
+				spec += ":" + fl.Name + ": "
+			}
+			specs = append(specs, shellQuote(spec))
+		})
+
+		cmdb, ok := cmd.(Branch)
+		if !ok {
+			_, dynamic := cmd.(Completer)
+			if dynamic {
+				specs = append(specs, shellQuote("*:arg:"+shellFuncName(fullname)+"_complete"))
+			} else {
+				specs = append(specs, shellQuote("*:arg:_files"))
+			}
+			fmt.Fprintf(bw, "\t_arguments \\\n\t\t%v\n", strings.Join(specs, " \\\n\t\t"))
+			fmt.Fprintf(bw, "}\n")
+
+			if dynamic {
+				// The words of the parent commands are shifted out of $words
+				// so the path to the command is passed instead.
+				path := strings.Split(fullname, " ")
+				for i := range path {
+					path[i] = shellQuote(path[i])
+				}
+				fmt.Fprintf(bw, "\n%v_complete() {\n", shellFuncName(fullname))
+				fmt.Fprintf(bw, "\tlocal -a candidates\n")
+				fmt.Fprintf(bw, "\tcandidates=(${(f)\"$(%v %v %v \"${(@)words[2,CURRENT-1]}\" \"${words[CURRENT]}\" 2> /dev/null)\"})\n",
+					path[0], completeCmd, strings.Join(path[1:], " "))
+				fmt.Fprintf(bw, "\tcompadd -a candidates\n")
+				fmt.Fprintf(bw, "}\n")
+			}
+			return
+		}
+
+		specs = append(specs, shellQuote("1: :->subcmds"), shellQuote("*:: :->args"))
+		fmt.Fprintf(bw, "\tlocal state line\n")
+		fmt.Fprintf(bw, "\t_arguments -C \\\n\t\t%v\n\n", strings.Join(specs, " \\\n\t\t"))
+		fmt.Fprintf(bw, "\tcase $state in\n")
+		fmt.Fprintf(bw, "\tsubcmds)\n")
+		fmt.Fprintf(bw, "\t\tlocal -a subcmds\n")
+		fmt.Fprintf(bw, "\t\tsubcmds=(\n")
+		for _, subcmd := range visibleSubcommands(cmdb) {
+			for _, name := range names(subcmd) {
+				fmt.Fprintf(bw, "\t\t\t%v\n", shellQuote(strings.Replace(name, ":", `\:`, -1)+":"+summary(subcmd)))
+			}
+		}
+		fmt.Fprintf(bw, "\t\t)\n")
+		fmt.Fprintf(bw, "\t\t_describe 'subcommand' subcmds\n")
+		fmt.Fprintf(bw, "\t\t;;\n")
+		fmt.Fprintf(bw, "\targs)\n")
+		fmt.Fprintf(bw, "\t\tcase $line[1] in\n")
+		for _, subcmd := range visibleSubcommands(cmdb) {
+			var patterns []string
+			for _, name := range names(subcmd) {
+				patterns = append(patterns, shellQuote(name))
+			}
+			fmt.Fprintf(bw, "\t\t%v)\n", strings.Join(patterns, " | "))
+			fmt.Fprintf(bw, "\t\t\t%v\n", shellFuncName(fullname+" "+subcmd.Name()))
+			fmt.Fprintf(bw, "\t\t\t;;\n")
+		}
+		fmt.Fprintf(bw, "\t\tesac\n")
+		fmt.Fprintf(bw, "\t\t;;\n")
+		fmt.Fprintf(bw, "\tesac\n")
+		fmt.Fprintf(bw, "}\n")
+	})
+
+	funcName := shellFuncName(c.rootName(cmd))
+	fmt.Fprintf(bw, "\nif [ \"$funcstack[1]\" = %v ]; then\n", shellQuote(funcName))
+	fmt.Fprintf(bw, "\t%v \"$@\"\n", funcName)
+	fmt.Fprintf(bw, "else\n")
+	fmt.Fprintf(bw, "\tcompdef %v %v\n", funcName, shellQuote(c.rootName(cmd)))
+	fmt.Fprintf(bw, "fi\n")
+
+	return bw.Flush()
+}
+
+// FishCompletion writes a fish completion script for cmd to w.
+// It can be saved in ~/.config/fish/completions/examplecli.fish
+// or loaded with:
+//
+//	examplecli completion fish | source
+func FishCompletion(w io.Writer, cmd Command) error {
+	return NewConfig().FishCompletion(w, cmd)
+}
+
+// FishCompletion is like the package level FishCompletion
+// but with the settings in c.
+func (c *Config) FishCompletion(w io.Writer, cmd Command) error {
+	bw := bufio.NewWriter(w)
+
+	name := c.rootName(cmd)
+	completeFunc := shellFuncName(name) + "_complete"
+	fmt.Fprintf(bw, "function %v\n", completeFunc)
+	fmt.Fprintf(bw, "\tset -l tokens (commandline -opc)\n")
+	fmt.Fprintf(bw, "\tset -e tokens[1]\n")
+	fmt.Fprintf(bw, "\tset -l cur (commandline -ct)\n")
+	fmt.Fprintf(bw, "\t%v %v $tokens \"$cur\"\n", fishQuote(name), completeCmd)
+	fmt.Fprintf(bw, "end\n")
+
+	isRoot := true
+	c.walk(cmd, func(fullname string, cmd Command, f *flag.FlagSet) {
+		// Fish has no notion of the command's path so the condition
+		// is whether the command's name was seen and none of its
+		// subcommands' names.
+		var conds []string
+		if isRoot {
+			if _, ok := cmd.(Branch); ok {
+				conds = append(conds, "__fish_use_subcommand")
+			}
+		} else {
+			conds = append(conds, "__fish_seen_subcommand_from "+strings.Join(names(cmd), " "))
+		}
+		if cmdb, ok := cmd.(Branch); ok && !isRoot {
+			var subnames []string
+			for _, subcmd := range visibleSubcommands(cmdb) {
+				subnames = append(subnames, names(subcmd)...)
+			}
+			if len(subnames) > 0 {
+				conds = append(conds, "not __fish_seen_subcommand_from "+strings.Join(subnames, " "))
+			}
+		}
+		isRoot = false
+
+		prefix := "complete -c " + fishQuote(name)
+		if len(conds) > 0 {
+			prefix += " -n " + fishQuote(strings.Join(conds, "; and "))
+		}
+
+		fmt.Fprintf(bw, "\n")
+		f.VisitAll(func(fl *flag.Flag) {
+			if isHiddenFlag(fl) {
+				return
+			}
+			line := prefix + " -o " + fishQuote(fl.Name)
+			if allowed := allowedValues(fl); len(allowed) > 0 {
+				line += " -r -f -a " + fishQuote(strings.Join(allowed, " "))
+			} else if !isBoolFlag(fl) {
+				line += " -r"
+			}
+			fmt.Fprintf(bw, "%v -d %v\n", line, fishQuote(fl.Usage))
+		})
+
+		switch cmdb := cmd.(type) {
+		case Branch:
+			for _, subcmd := range visibleSubcommands(cmdb) {
+				for _, subname := range names(subcmd) {
+					fmt.Fprintf(bw, "%v -f -a %v -d %v\n", prefix, fishQuote(subname), fishQuote(summary(subcmd)))
+				}
+			}
+		case Completer:
+			fmt.Fprintf(bw, "%v -f -a %v\n", prefix, fishQuote("("+completeFunc+")"))
+		}
+	})
+
+	return bw.Flush()
+}
+
+// InstallCompletion writes the completion script for shell, bash, zsh or fish,
+// for cmd to w followed by comments explaining how to load it.
+// The comments refer to the running binary and the arguments it was
+// invoked with, e.g. "examplecli completion bash", so it should be
+// called from the command that prints the script.
+func InstallCompletion(w io.Writer, cmd Command, shell string) error {
+	return NewConfig().InstallCompletion(w, cmd, shell)
+}
+
+// InstallCompletion is like the package level InstallCompletion
+// but with the settings in c.
+func (c *Config) InstallCompletion(w io.Writer, cmd Command, shell string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	invocation := []string{shellQuote(exe)}
+	for _, arg := range os.Args[1:] {
+		invocation = append(invocation, shellQuote(arg))
+	}
+	source := fmt.Sprintf("source <(%v)", strings.Join(invocation, " "))
+
+	var dest string
+	switch shell {
+	case "bash":
+		err = c.BashCompletion(w, cmd)
+		dest = "~/.local/share/bash-completion/completions/" + c.rootName(cmd)
+	case "zsh":
+		err = c.ZshCompletion(w, cmd)
+		dest = "a directory in $fpath, e.g. ~/.zsh/completions/_" + c.rootName(cmd)
+	case "fish":
+		err = c.FishCompletion(w, cmd)
+		source = strings.Join(invocation, " ") + " | source"
+		dest = "~/.config/fish/completions/" + c.rootName(cmd) + ".fish"
+	default:
+		return fmt.Errorf("unsupported shell %q: must be bash, zsh or fish", shell)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, `
+# To load the completions in the current shell, run:
+#
+#	%v
+#
+# To load them in every session, save this script to:
+#
+#	%v
+`, source, dest)
+	return err
+}
+
+// completionValue is the value of the -completion flag. It is a bool
+// flag that also accepts the shell to print the completion script for.
+// fromEnv reports whether the shell was taken from $SHELL because the
+// flag was passed without a value.
+type completionValue struct {
+	set     bool
+	shell   string
+	fromEnv bool
+}
+
+func (c *completionValue) Set(s string) error {
+	switch s {
+	case "true":
+		c.set, c.shell, c.fromEnv = true, os.Getenv("SHELL"), true
+		if c.shell != "" {
+			c.shell = filepath.Base(c.shell)
+		}
+	case "false":
+		c.set, c.shell, c.fromEnv = false, "", false
+	default:
+		c.set, c.shell, c.fromEnv = true, s, false
+	}
+	return nil
+}
+
+func (c *completionValue) String() string {
+	if c == nil || !c.set {
+		return ""
+	}
+	return c.shell
+}
+
+func (c *completionValue) IsBoolFlag() bool {
+	return true
+}
+
+// isCompletionShell reports whether the package
+// can print the completion script for shell.
+func isCompletionShell(shell string) bool {
+	switch shell {
+	case "bash", "zsh", "fish":
+		return true
+	}
+	return false
+}
+
+// Completer is implemented by leaves that can complete their
+// arguments dynamically, e.g. with the names of remote branches.
+// The completion scripts call back into the CLI to get them.
+type Completer interface {
+	Leaf
+
+	// Complete returns the candidates for the argument being completed.
+	// args are the arguments before it and toComplete is what has been
+	// typed of it so far.
+	Complete(ctx context.Context, args []string, toComplete string) []string
+}
+
+// completeCmd is the hidden command the completion scripts invoke to
+// complete the arguments of a Completer. It is passed the words on the
+// command line after the program name with the word being completed last.
+const completeCmd = "__complete"
+
+// complete runs the hidden completion command with args.
+// The candidates are written to Stdout, one per line.
+func complete(ctx context.Context, cmd Command, args []string) int {
+	if len(args) == 0 {
+		return StatusError
+	}
+	toComplete := args[len(args)-1]
+	words := args[:len(args)-1]
+
+	c := config(ctx)
+	fullname, cmd, f, words, err := c.resolve(cmd, words)
+	if err != nil {
+		return StatusOK
+	}
+	ccmd, ok := cmd.(Completer)
+	if !ok {
+		return StatusOK
+	}
+	cmdArgs, _ := splitArgs(f, words, false)
+
+	ctx = context.WithValue(ctx, fullnameKey{}, fullname)
+	for _, candidate := range ccmd.Complete(ctx, cmdArgs, toComplete) {
+		fmt.Fprintln(c.stdout(), candidate)
+	}
+	return StatusOK
+}
+
+// splitArgs removes the flags and their values from words and returns
+// the remaining arguments. If branch is true, it stops after the first
+// argument, the subcommand, and returns the words after it as rest.
+func splitArgs(f *flag.FlagSet, words []string, branch bool) (args, rest []string) {
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if w == "--" {
+			return append(args, words[i+1:]...), nil
+		}
+		if !strings.HasPrefix(w, "-") || w == "-" {
+			args = append(args, w)
+			if branch {
+				return args, words[i+1:]
+			}
+			continue
+		}
+
+		name := strings.TrimLeft(w, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		fl := f.Lookup(name)
+		if fl != nil && !isBoolFlag(fl) {
+			i++
+		}
+	}
+	return args, nil
+}
+
+// zshEscape escapes the characters in s that are special
+// in the description of an _arguments spec.
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// isBoolFlag reports whether fl does not take a value.
+func isBoolFlag(fl *flag.Flag) bool {
+	bf, ok := fl.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && bf.IsBoolFlag()
+}
+
+// allowedValues returns the values fl accepts if it
+// restricts them, e.g. because it was defined with EnumVar.
+func allowedValues(fl *flag.Flag) []string {
+	av, ok := unwrapFlag(fl).Value.(interface {
+		Allowed() []string
+	})
+	if !ok {
+		return nil
+	}
+	return av.Allowed()
+}
+
+var shellFuncNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// shellFuncName returns the name of the completion function for
+// the command named name.
+func shellFuncName(name string) string {
+	return "_" + shellFuncNameRegexp.ReplaceAllString(name, "_")
+}
+
+// fishQuote quotes s for use as a single word in a fish script.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+// shellQuote quotes s for use as a single word in a shell script.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+type testCompleterLeaf struct {
+	testLeaf
+}
+
+func (l *testCompleterLeaf) Complete(ctx context.Context, args []string, toComplete string) []string {
+	var candidates []string
+	for _, c := range []string{"alpha", "beta", "bravo"} {
+		if strings.HasPrefix(c, toComplete) {
+			candidates = append(candidates, FullName(ctx)+":"+strings.Join(args, ",")+":"+c)
+		}
+	}
+	return candidates
+}
+
+func testCompletionTree() Command {
+	return &testPersistentBranch{
+		testBranch: testBranch{
+			name: "root",
+			subcmds: []Command{
+				&testCompleterLeaf{
+					testLeaf: testLeaf{
+						name:    "ls",
+						aliases: []string{"list"},
+						flags: func(f *flag.FlagSet) {
+							f.Bool("l", false, "Use long format.")
+							f.String("sort", "", "Sort order.")
+							var format string
+							EnumVar(f, &format, "format", []string{"json", "text"}, "text", "Output format.")
+						},
+					},
+				},
+				&testBranch{
+					name: "remote",
+					subcmds: []Command{
+						&testLeaf{name: "add"},
+					},
+				},
+			},
+		},
+		persistentFlags: func(f *flag.FlagSet) {
+			f.Bool("verbose", false, "Enable verbose output.")
+		},
+	}
+}
+
+func TestBashCompletion(t *testing.T) {
+	var b bytes.Buffer
+	err := BashCompletion(&b, testCompletionTree())
+	if err != nil {
+		t.Fatalf("failed to generate bash completion: %v", err)
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+
+	complete := func(words ...string) string {
+		script := b.String() + `
+COMP_WORDS=("$@")
+COMP_CWORD=$(($# - 1))
+_root
+echo "${COMPREPLY[*]}"
+`
+		out, err := exec.CommandContext(context.Background(), bash, append([]string{"-c", script, "bash"}, words...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("failed to run completion: %v: %s", err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	testCases := []struct {
+		words []string
+		want  string
+	}{
+		{words: []string{"root", ""}, want: "ls list remote -help -verbose -version"},
+		{words: []string{"root", "r"}, want: "remote"},
+		{words: []string{"root", "list", "-"}, want: "-format -help -l -sort -verbose -version"},
+		{words: []string{"root", "list", "-format", ""}, want: "json text"},
+		{words: []string{"root", "list", "--format", "j"}, want: "json"},
+		{words: []string{"root", "-verbose", "remote", ""}, want: "add -help -verbose -version"},
+	}
+
+	for _, tc := range testCases {
+		got := complete(tc.words...)
+		if got != tc.want {
+			t.Errorf("completion of %q = %q; want %q", tc.words, got, tc.want)
+		}
+	}
+}
+
+func TestCompletionProgramName(t *testing.T) {
+	c := &Config{ProgramName: "mytool"}
+
+	var b bytes.Buffer
+	err := c.BashCompletion(&b, testCompletionTree())
+	if err != nil {
+		t.Fatalf("failed to generate bash completion: %v", err)
+	}
+	if !strings.Contains(b.String(), "\tlocal path='mytool'\n") || !strings.HasSuffix(b.String(), "complete -F _mytool 'mytool'\n") {
+		t.Errorf("bash script does not complete mytool: %q", b.String())
+	}
+
+	b.Reset()
+	err = c.ZshCompletion(&b, testCompletionTree())
+	if err != nil {
+		t.Fatalf("failed to generate zsh completion: %v", err)
+	}
+	if !strings.HasPrefix(b.String(), "#compdef mytool\n") || !strings.Contains(b.String(), "\tcompdef _mytool 'mytool'\n") {
+		t.Errorf("zsh script does not complete mytool: %q", b.String())
+	}
+
+	b.Reset()
+	err = c.FishCompletion(&b, testCompletionTree())
+	if err != nil {
+		t.Fatalf("failed to generate fish completion: %v", err)
+	}
+	if strings.Contains(b.String(), "'root'") {
+		t.Errorf("fish script completes root: %q", b.String())
+	}
+
+	d := c.Describe(testCompletionTree())
+	if d.FullName != "mytool" || d.Subcommands[0].FullName != "mytool ls" {
+		t.Errorf("unexpected full names %q and %q", d.FullName, d.Subcommands[0].FullName)
+	}
+}
+
+func TestZshCompletion(t *testing.T) {
+	var b bytes.Buffer
+	err := ZshCompletion(&b, testCompletionTree())
+	if err != nil {
+		t.Fatalf("failed to generate zsh completion: %v", err)
+	}
+
+	for _, want := range []string{"#compdef root", "_root_remote_add()", `'-l[Use long format.]'`, `'list:Test leaf.'`, `'-format[Output format. (one of\: json, text)]:format:(json text)'`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("script does not contain %q", want)
+		}
+	}
+
+	zsh, err := exec.LookPath("zsh")
+	if err != nil {
+		t.Skip("zsh not available")
+	}
+
+	cmd := exec.CommandContext(context.Background(), zsh, "-n")
+	cmd.Stdin = &b
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated script does not parse: %v: %s", err, out)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"ls", ""}, want: "root ls::alpha\nroot ls::beta\nroot ls::bravo\n"},
+		{args: []string{"-verbose", "list", "-sort", "size", "x", "-l", "b"}, want: "root ls:x:beta\nroot ls:x:bravo\n"},
+		{args: []string{"remote", "add", ""}, want: ""},
+		{args: []string{"unknown", ""}, want: ""},
+	}
+
+	for _, tc := range testCases {
+		status, stdout, _ := runTest(t, testCompletionTree(), append([]string{"__complete"}, tc.args...)...)
+		if status != 0 || stdout != tc.want {
+			t.Errorf("completion of %q = %v, %q; want %q", tc.args, status, stdout, tc.want)
+		}
+	}
+}
+
+func TestFishCompletion(t *testing.T) {
+	var b bytes.Buffer
+	err := FishCompletion(&b, testCompletionTree())
+	if err != nil {
+		t.Fatalf("failed to generate fish completion: %v", err)
+	}
+
+	for _, want := range []string{
+		"complete -c 'root' -n '__fish_use_subcommand' -f -a 'list' -d 'Test leaf.'\n",
+		"complete -c 'root' -n '__fish_seen_subcommand_from ls list' -o 'sort' -r -d 'Sort order.'\n",
+		"complete -c 'root' -n '__fish_seen_subcommand_from ls list' -o 'format' -r -f -a 'json text' -d",
+		"complete -c 'root' -n '__fish_seen_subcommand_from ls list' -f -a '(_root_complete)'\n",
+		"complete -c 'root' -n '__fish_seen_subcommand_from remote; and not __fish_seen_subcommand_from add' -f -a 'add'",
+		"complete -c 'root' -n '__fish_seen_subcommand_from add' -o 'verbose' -d",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("script does not contain %q: %s", want, b.String())
+		}
+	}
+
+	fish, err := exec.LookPath("fish")
+	if err != nil {
+		t.Skip("fish not available")
+	}
+
+	cmd := exec.CommandContext(context.Background(), fish, "-n")
+	cmd.Stdin = &b
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated script does not parse: %v: %s", err, out)
+	}
+}
+
+func TestInstallCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var b bytes.Buffer
+		err := InstallCompletion(&b, testCompletionTree(), shell)
+		if err != nil {
+			t.Fatalf("%v: %v", shell, err)
+		}
+
+		script := b.String()
+		if shell == "zsh" && !strings.HasPrefix(script, "#compdef root\n") {
+			t.Errorf("zsh script does not start with #compdef: %q", script)
+		}
+		if !strings.Contains(script, "# To load the completions in the current shell, run:\n#\n#\t") {
+			t.Errorf("%v: instructions missing: %q", shell, script)
+		}
+	}
+
+	err := InstallCompletion(ioutil.Discard, testCompletionTree(), "tcsh")
+	if err == nil || !strings.Contains(err.Error(), `unsupported shell "tcsh"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCompletionFlag(t *testing.T) {
+	c := &Config{CompletionFlag: true}
+
+	defer os.Setenv("SHELL", os.Getenv("SHELL"))
+	os.Setenv("SHELL", "/usr/bin/zsh")
+
+	testCases := []struct {
+		args   []string
+		status int
+		stdout string
+		stderr string
+	}{
+		{args: []string{"-completion"}, stdout: "#compdef root\n"},
+		{args: []string{"--completion=fish"}, stdout: "function _root_complete\n"},
+		{args: []string{"-completion", "fish"}, status: 2, stderr: "root: unexpected argument \"fish\": pass the shell as -completion=fish\n"},
+		{args: []string{"-completion", "ls"}, status: 2, stderr: "root: unexpected argument \"ls\"\n\n"},
+		{args: []string{"-completion=zsh", "ls"}, status: 2, stderr: "root: unexpected argument \"ls\"\n\n"},
+		{args: []string{"-completion=zsh", "fish"}, status: 2, stderr: "root: unexpected argument \"fish\"\n\n"},
+		{args: []string{"-completion=tcsh"}, status: 1, stderr: "root: unsupported shell \"tcsh\": must be bash, zsh or fish\n"},
+		{args: []string{"remote", "-completion"}, status: 2, stderr: "root remote: flag provided but not defined: -completion\n"},
+	}
+
+	for _, tc := range testCases {
+		status, stdout, stderr := runTestConfig(t, c, testCompletionTree(), tc.args...)
+		if status != tc.status || !strings.HasPrefix(stdout, tc.stdout) || !strings.HasPrefix(stderr, tc.stderr) {
+			t.Errorf("%q: unexpected status %v, stdout %q and stderr %q", tc.args, status, stdout, stderr)
+		}
+	}
+
+	_, _, stderr := runTestConfig(t, c, testCompletionTree(), "-h")
+	if !strings.Contains(stderr, "\n  -completion\n") {
+		t.Fatalf("-completion not in help: %q", stderr)
+	}
+}
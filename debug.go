@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// debugGrace is how long a leaf may keep running after its context
+// is cancelled without checking it before CLI_DEBUG warns about it.
+var debugGrace = time.Second
+
+// debug reports whether CLI_DEBUG=1 is set in the environment.
+// In debug mode, the CLI warns when a leaf returns long after its
+// context was cancelled without having checked it, e.g. because it
+// used context.Background() instead of the context passed to Run.
+func debug() bool {
+	return os.Getenv("CLI_DEBUG") == "1"
+}
+
+// watchedContext records whether the command checked
+// whether the context was cancelled.
+type watchedContext struct {
+	context.Context
+	observed int32
+}
+
+func (c *watchedContext) Done() <-chan struct{} {
+	atomic.StoreInt32(&c.observed, 1)
+	return c.Context.Done()
+}
+
+func (c *watchedContext) Err() error {
+	atomic.StoreInt32(&c.observed, 1)
+	return c.Context.Err()
+}
+
+// watchContext returns ctx wrapped to record whether the leaf checks
+// it along with a function to call once the leaf returns that warns
+// if the leaf ignored ctx being cancelled for longer than debugGrace.
+func watchContext(ctx context.Context) (context.Context, func()) {
+	wctx := &watchedContext{Context: ctx}
+
+	var (
+		mu          sync.Mutex
+		cancelledAt time.Time
+	)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			cancelledAt = time.Now()
+			mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	return wctx, func() {
+		close(stop)
+		<-stopped
+
+		mu.Lock()
+		defer mu.Unlock()
+		if cancelledAt.IsZero() || atomic.LoadInt32(&wctx.observed) == 1 {
+			return
+		}
+		if d := time.Since(cancelledAt); d > debugGrace {
+			fmt.Fprintf(config(ctx).stderr(), "%v: warning: command returned %v after its context was cancelled without checking it\n", FullName(ctx), d.Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugContext(t *testing.T) {
+	os.Setenv("CLI_DEBUG", "1")
+	debugGrace = 10 * time.Millisecond
+	defer func() {
+		os.Unsetenv("CLI_DEBUG")
+		debugGrace = time.Second
+	}()
+	c := &Config{Timeout: time.Millisecond}
+
+	testCases := []struct {
+		name string
+		run  func(ctx context.Context, args []string) int
+		warn bool
+	}{
+		{
+			name: "ignored",
+			run: func(ctx context.Context, args []string) int {
+				time.Sleep(50 * time.Millisecond)
+				return 0
+			},
+			warn: true,
+		},
+		{
+			name: "observed",
+			run: func(ctx context.Context, args []string) int {
+				<-ctx.Done()
+				time.Sleep(50 * time.Millisecond)
+				return 0
+			},
+		},
+		{
+			name: "quick",
+			run: func(ctx context.Context, args []string) int {
+				return 0
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		_, _, stderr := runTestConfig(t, c, &testLeaf{name: "root", run: tc.run})
+		warned := strings.Contains(stderr, "root: warning: command returned ")
+		if warned != tc.warn {
+			t.Errorf("%v: unexpected stderr %q", tc.name, stderr)
+		}
+	}
+}
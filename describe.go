@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"flag"
+)
+
+// Description describes a command and its descendants.
+// It can be marshalled to JSON for documentation generators and
+// other tools that need to know the available commands and flags.
+type Description struct {
+	Name        string            `json:"name"`
+	FullName    string            `json:"fullName"`
+	Aliases     []string          `json:"aliases,omitempty"`
+	Desc        string            `json:"desc,omitempty"`
+	Usage       string            `json:"usage"`
+	Flags       []FlagDescription `json:"flags,omitempty"`
+	Subcommands []Description     `json:"subcommands,omitempty"`
+}
+
+// FlagDescription describes a flag of a command.
+type FlagDescription struct {
+	Name    string `json:"name"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// Describe returns the description of cmd and its descendants.
+// Hidden commands are left out.
+func Describe(cmd Command) Description {
+	return NewConfig().Describe(cmd)
+}
+
+// Describe is like the package level Describe
+// but with the settings in c.
+func (c *Config) Describe(cmd Command) Description {
+	persistent, _, _ := c.rootFlags()
+	return c.describe(c.rootName(cmd), cmd, persistent, newFlagCache())
+}
+
+func (c *Config) describe(fullname string, cmd Command, persistent []*flag.Flag, cache *flagCache) Description {
+	f, persistent := c.newFlagSet(fullname, cmd, persistent, cache)
+	c.builtinFlags(f)
+
+	d := Description{
+		Name:     cmd.Name(),
+		FullName: fullname,
+		Desc:     cmd.Desc(),
+		Usage:    usage(cmd, f),
+	}
+
+	if aliases := names(cmd)[1:]; len(aliases) > 0 {
+		d.Aliases = aliases
+	}
+
+	f.VisitAll(func(fl *flag.Flag) {
+		if isHiddenFlag(fl) {
+			return
+		}
+		d.Flags = append(d.Flags, FlagDescription{
+			Name:    fl.Name,
+			Default: fl.DefValue,
+			Usage:   fl.Usage,
+		})
+	})
+
+	if cmd, ok := cmd.(Branch); ok {
+		for _, subcmd := range visibleSubcommands(cmd) {
+			d.Subcommands = append(d.Subcommands, c.describe(fullname+" "+subcmd.Name(), subcmd, persistent, cache))
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	d := Describe(testCompletionTree())
+
+	if d.Name != "root" || len(d.Subcommands) != 2 {
+		t.Fatalf("unexpected description: %+v", d)
+	}
+
+	ls := d.Subcommands[0]
+	if ls.FullName != "root ls" || !reflect.DeepEqual(ls.Aliases, []string{"list"}) || ls.Desc != "Test leaf." {
+		t.Fatalf("unexpected description of ls: %+v", ls)
+	}
+
+	exp := FlagDescription{Name: "l", Default: "false", Usage: "Use long format."}
+	if !reflect.DeepEqual(ls.Flags[2], exp) {
+		t.Fatalf("unexpected flag %+v; expected %+v", ls.Flags[2], exp)
+	}
+
+	add := d.Subcommands[1].Subcommands[0]
+	if add.FullName != "root remote add" {
+		t.Fatalf("unexpected description of add: %+v", add)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("failed to marshal description: %v", err)
+	}
+	var d2 Description
+	err = json.Unmarshal(b, &d2)
+	if err != nil {
+		t.Fatalf("failed to unmarshal description: %v", err)
+	}
+	if !reflect.DeepEqual(d, d2) {
+		t.Fatalf("description changed after round trip:\n%+v\n%+v", d, d2)
+	}
+}
+
+func TestHelpJSON(t *testing.T) {
+	status, stdout, stderr := runTest(t, testCompletionTree(), "remote", "-help=json")
+	if status != 0 || stderr != "" {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	var d Description
+	err := json.Unmarshal([]byte(stdout), &d)
+	if err != nil {
+		t.Fatalf("failed to unmarshal %q: %v", stdout, err)
+	}
+	if d.FullName != "root remote" || len(d.Subcommands) != 1 || d.Subcommands[0].Name != "add" {
+		t.Fatalf("unexpected description: %+v", d)
+	}
+	if !strings.Contains(stdout, "\n\t\"usage\": \"[flags...] <subcmd>\",\n") {
+		t.Fatalf("usage escaped or not indented: %q", stdout)
+	}
+
+	status, _, stderr = runTest(t, testCompletionTree(), "-help=true")
+	if status != 0 || !strings.HasPrefix(stderr, "Usage:") {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	status, _, stderr = runTest(t, testCompletionTree(), "-help=yaml")
+	if status != 2 || !strings.Contains(stderr, "must be a boolean or json") {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+}
@@ -3,8 +3,6 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
-	"os"
 	"os/exec"
 	"time"
 
@@ -14,9 +12,10 @@ import (
 )
 
 func main() {
-	log.SetFlags(0)
+	c := cli.NewConfig()
+	c.Timeout = time.Second * 10
 	ctx := context.Background()
-	cli.Run(ctx, &rootCmd{})
+	c.RunSignal(ctx, &rootCmd{})
 }
 
 type rootCmd struct {
@@ -51,7 +50,8 @@ type lsCmd struct {
 	long    bool
 }
 
-var _ cli.Leaf = &lsCmd{}
+var _ cli.ArgCount = &lsCmd{}
+var _ cli.Exampled = &lsCmd{}
 
 func (lsCmd *lsCmd) Name() string {
 	return "ls"
@@ -61,11 +61,19 @@ func (lsCmd *lsCmd) Usage() string {
 	return "<dir>"
 }
 
+func (lsCmd *lsCmd) NArgs() (min, max int) {
+	return 1, 1
+}
+
 func (lsCmd *lsCmd) Desc() string {
 	return `Lists a directory.
 Can do other cool things too.`
 }
 
+func (lsCmd *lsCmd) Examples() []string {
+	return []string{"examplecli ls -l /tmp"}
+}
+
 func (lsCmd *lsCmd) Flags(f *flag.FlagSet) {
 	f.BoolVar(&lsCmd.long, "l", false, "Use long format.")
 }
@@ -74,24 +82,17 @@ func (lsCmd *lsCmd) Run(ctx context.Context, args []string) int {
 	if lsCmd.rootCmd.fail != 0 {
 		return lsCmd.rootCmd.fail
 	}
-	if len(args) != 1 {
-		return cli.Helpf(ctx, "directory required")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
 	ls := exec.CommandContext(ctx, "ls")
 	if lsCmd.long {
 		ls.Args = append(ls.Args, "-l")
 	}
 	ls.Args = append(ls.Args, args[0])
-	ls.Stdin = os.Stdin
-	ls.Stdout = os.Stdout
-	ls.Stderr = os.Stderr
+	ls.Stdin = cli.Stdin(ctx)
+	ls.Stdout = cli.Stdout(ctx)
+	ls.Stderr = cli.Stderr(ctx)
 	err := ls.Start()
 	if err != nil {
-		log.Printf("failed to run %q: %v", ls.Args, err)
+		cli.Logger(ctx).Printf("failed to run %q: %v", ls.Args, err)
 		return 1
 	}
 
@@ -99,9 +100,9 @@ func (lsCmd *lsCmd) Run(ctx context.Context, args []string) int {
 	if err != nil {
 		cerr := &exec.ExitError{}
 		if !xerrors.As(err, &cerr) {
-			log.Printf("failed to wait for %q: %v", ls.Args, err)
-			return 1
+			cli.Logger(ctx).Printf("failed to wait for %q: %v", ls.Args, err)
 		}
+		return cli.ExitCode(err)
 	}
 
 	return 0
@@ -0,0 +1,819 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// flagInfo holds what the package knows about a flag
+// beyond what the flag package tracks.
+type flagInfo struct {
+	// env is the environment variable the flag falls back to.
+	env string
+	// config is whether the flag's value is the path to a config file.
+	config bool
+	// short is the name of the short form of the flag.
+	short string
+	// shortFor is the name of the flag this flag is the short form of.
+	shortFor string
+	// exclusive is the names of the flags that may not be set with the flag.
+	exclusive []string
+	// hidden is whether the flag is left out of help and completions.
+	hidden bool
+	// group is the heading the flag is listed under in help.
+	group string
+}
+
+// lookupFlag returns the flag named name in f and its info.
+// The info is kept in an infoValue wrapping the flag's value so that
+// it is shared by the copies of the flag in the flagsets built for a
+// command and released along with the flag.
+// It panics if the flag is not defined.
+func lookupFlag(f *flag.FlagSet, name string) (*flag.Flag, *flagInfo) {
+	fl := f.Lookup(name)
+	if fl == nil {
+		panicRegistration(f.Name(), "flag -%v is not defined", name)
+	}
+
+	iv, ok := fl.Value.(*infoValue)
+	if !ok {
+		iv = &infoValue{Value: fl.Value}
+		fl.Value = iv
+	}
+	return fl, &iv.info
+}
+
+// getFlagInfo returns the info for fl.
+func getFlagInfo(fl *flag.Flag) flagInfo {
+	iv, ok := fl.Value.(*infoValue)
+	if !ok {
+		return flagInfo{}
+	}
+	return iv.info
+}
+
+// infoValue wraps the value of a flag the package
+// knows more about than the flag package.
+type infoValue struct {
+	flag.Value
+	info flagInfo
+}
+
+func (v *infoValue) String() string {
+	if v.Value == nil {
+		return ""
+	}
+	return v.Value.String()
+}
+
+func (v *infoValue) IsBoolFlag() bool {
+	bf, ok := v.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && bf.IsBoolFlag()
+}
+
+func (v *infoValue) Get() interface{} {
+	if g, ok := v.Value.(flag.Getter); ok {
+		return g.Get()
+	}
+	return v.String()
+}
+
+// EnvVar makes the flag named name in f fall back to the environment
+// variable env when it is not set on the command line.
+// The flag must already be defined and the environment variable is
+// appended to its usage.
+//
+// It should be called from Flags after the flag is defined.
+func EnvVar(f *flag.FlagSet, name, env string) {
+	fl, fi := lookupFlag(f, name)
+	fi.env = env
+	fl.Usage += fmt.Sprintf(" (env: %v)", env)
+}
+
+// ConfigFile makes the string flag named name in f designate a config
+// file from which the other flags in f that are not set on the command
+// line or from the environment are set.
+// The flag must already be defined. If its value is empty, no config
+// file is read.
+//
+// The config file contains a key = value pair per line where the key
+// is the name of a flag. Blank lines and lines starting with # are
+// ignored. E.g.
+//
+//	# Use the long format.
+//	l = true
+//
+// It should be called from Flags after the flag is defined.
+func ConfigFile(f *flag.FlagSet, name string) {
+	_, fi := lookupFlag(f, name)
+	fi.config = true
+}
+
+// ExclusiveFlags makes the flags in f named names mutually exclusive.
+// Setting more than one of them on the command line is an error.
+// The flags must already be defined.
+//
+// It should be called from Flags after the flags are defined.
+func ExclusiveFlags(f *flag.FlagSet, names ...string) {
+	for _, name := range names {
+		_, fi := lookupFlag(f, name)
+		for _, other := range names {
+			if other != name {
+				fi.exclusive = append(fi.exclusive, other)
+			}
+		}
+	}
+}
+
+// checkExclusive returns an error if more than one of a set of
+// flags made mutually exclusive with ExclusiveFlags were set.
+func checkExclusive(f *flag.FlagSet) error {
+	set := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+
+	var err error
+	f.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		for _, other := range getFlagInfo(fl).exclusive {
+			if set[other] {
+				err = fmt.Errorf("flags -%v and -%v are mutually exclusive", fl.Name, other)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// setFallbacks sets the flags in f that were not set on the command line
+// from their environment variables and then from the config file.
+// Flags inherited from ancestors are skipped as they were already set
+// when the ancestors were run.
+func setFallbacks(f *flag.FlagSet, inherited []*flag.Flag) error {
+	skip := make(map[string]bool)
+	for _, fl := range inherited {
+		skip[fl.Name] = true
+	}
+
+	err := setFromEnv(f, skip)
+	if err != nil {
+		return err
+	}
+	return setFromConfig(f, skip)
+}
+
+// setFromEnv sets the flags in f that were not set on the command line
+// from the environment variables they fall back to.
+func setFromEnv(f *flag.FlagSet, skip map[string]bool) error {
+	set := setFlags(f)
+
+	var err error
+	f.VisitAll(func(fl *flag.Flag) {
+		if err != nil || set[fl.Name] || skip[fl.Name] {
+			return
+		}
+
+		env := getFlagInfo(fl).env
+		if env == "" {
+			return
+		}
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return
+		}
+
+		err = f.Set(fl.Name, v)
+		if err != nil {
+			err = fmt.Errorf("invalid value %q for flag -%v from $%v: %v", redact(fl, v), fl.Name, env, err)
+		}
+	})
+	return err
+}
+
+// setFromConfig sets the flags in f that are not yet set
+// from the config file designated with ConfigFile.
+func setFromConfig(f *flag.FlagSet, skip map[string]bool) error {
+	var path string
+	f.VisitAll(func(fl *flag.Flag) {
+		if getFlagInfo(fl).config {
+			path = fl.Value.String()
+		}
+	})
+	if path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	set := setFlags(f)
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("%v:%v: expected key = value", path, i+1)
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+
+		if f.Lookup(key) == nil {
+			return fmt.Errorf("%v:%v: flag -%v is not defined", path, i+1, key)
+		}
+		if set[key] || skip[key] {
+			continue
+		}
+
+		err = f.Set(key, value)
+		if err != nil {
+			return fmt.Errorf("%v:%v: invalid value %q for flag -%v: %v", path, i+1, redact(f.Lookup(key), value), key, err)
+		}
+	}
+	return nil
+}
+
+// setFlags returns the names of the flags set in f.
+func setFlags(f *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+	return set
+}
+
+// CountVar defines a flag with the specified name and usage that counts
+// how many times it is set into p, e.g. -v -v -v sets p to 3.
+// It is displayed like a bool flag in help.
+//
+// The flag package does not support combined short flags so -vvv is
+// not equivalent to -v -v -v.
+func CountVar(f *flag.FlagSet, p *int, name, usage string) {
+	*p = 0
+	f.Var((*countValue)(p), name, usage)
+}
+
+type countValue int
+
+func (c *countValue) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if v {
+		*c++
+	} else {
+		*c = 0
+	}
+	return nil
+}
+
+func (c *countValue) String() string {
+	if c == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(*c))
+}
+
+func (c *countValue) IsBoolFlag() bool {
+	return true
+}
+
+// EnumVar defines a string flag that only accepts the values in allowed.
+// Any other value is rejected when parsing. The allowed values are
+// appended to its usage.
+func EnumVar(f *flag.FlagSet, p *string, name string, allowed []string, value, usage string) {
+	*p = value
+	usage += fmt.Sprintf(" (one of: %v)", strings.Join(allowed, ", "))
+	f.Var(&enumValue{p: p, allowed: allowed}, name, usage)
+}
+
+type enumValue struct {
+	p       *string
+	allowed []string
+}
+
+func (e *enumValue) Set(s string) error {
+	for _, v := range e.allowed {
+		if s == v {
+			*e.p = s
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %v", strings.Join(e.allowed, ", "))
+}
+
+func (e *enumValue) String() string {
+	if e == nil || e.p == nil {
+		return ""
+	}
+	return *e.p
+}
+
+// Allowed returns the values the flag accepts.
+// The completion scripts offer them as the values of the flag.
+func (e *enumValue) Allowed() []string {
+	return e.allowed
+}
+
+// DurationVar is like flag.DurationVar but its error for an invalid
+// duration lists the valid units.
+func DurationVar(f *flag.FlagSet, p *time.Duration, name string, value time.Duration, usage string) {
+	*p = value
+	f.Var((*durationValue)(p), name, usage)
+}
+
+type durationValue time.Duration
+
+func (d *durationValue) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return xerrors.New("must be a duration like 1h30m; valid units are ns, us, ms, s, m, h")
+	}
+	*d = durationValue(v)
+	return nil
+}
+
+func (d *durationValue) String() string {
+	if d == nil {
+		return time.Duration(0).String()
+	}
+	return time.Duration(*d).String()
+}
+
+func (d *durationValue) valueName() string {
+	return "duration"
+}
+
+// TimeVar defines a time flag that parses its value with layout,
+// or time.RFC3339 if layout is empty. The layout is appended to
+// its usage.
+func TimeVar(f *flag.FlagSet, p *time.Time, name, layout string, value time.Time, usage string) {
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	*p = value
+	usage += fmt.Sprintf(" (format: %v)", layout)
+	f.Var(&timeValue{p: p, layout: layout}, name, usage)
+}
+
+type timeValue struct {
+	p      *time.Time
+	layout string
+}
+
+func (t *timeValue) Set(s string) error {
+	v, err := time.Parse(t.layout, s)
+	if err != nil {
+		return fmt.Errorf("must be a time in the format %v", t.layout)
+	}
+	*t.p = v
+	return nil
+}
+
+func (t *timeValue) String() string {
+	if t == nil || t.p == nil || t.p.IsZero() {
+		return ""
+	}
+	return t.p.Format(t.layout)
+}
+
+func (t *timeValue) valueName() string {
+	return "time"
+}
+
+// SecretVar defines a string flag for a secret, e.g. a token or a
+// password. Its default is left out of help and descriptions show it
+// as ****. Its value is also shown as **** in errors about invalid
+// values, including those set from the environment or a config file.
+func SecretVar(f *flag.FlagSet, p *string, name, value, usage string) {
+	*p = value
+	f.Var((*secretValue)(p), name, usage)
+}
+
+type secretValue string
+
+func (v *secretValue) Set(s string) error {
+	*v = secretValue(s)
+	return nil
+}
+
+func (v *secretValue) String() string {
+	return redacted
+}
+
+func (v *secretValue) valueName() string {
+	return "secret"
+}
+
+func (v *secretValue) secret() {}
+
+// SecretIntVar is like SecretVar but for an int flag, e.g. a PIN.
+func SecretIntVar(f *flag.FlagSet, p *int, name string, value int, usage string) {
+	*p = value
+	f.Var((*secretIntValue)(p), name, usage)
+}
+
+type secretIntValue int
+
+func (v *secretIntValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return xerrors.New("must be an integer")
+	}
+	*v = secretIntValue(i)
+	return nil
+}
+
+func (v *secretIntValue) String() string {
+	return redacted
+}
+
+func (v *secretIntValue) valueName() string {
+	return "secret"
+}
+
+func (v *secretIntValue) secret() {}
+
+// redacted is shown instead of the values of secret flags.
+const redacted = "****"
+
+// redact returns value, the value of fl, or redacted if fl is a secret.
+func redact(fl *flag.Flag, value string) string {
+	if _, ok := unwrapFlag(fl).Value.(interface{ secret() }); ok {
+		return redacted
+	}
+	return value
+}
+
+// FileOrStringVar defines a string flag whose value is read from a
+// file if it is prefixed with @, e.g. -token @/secrets/token, so that
+// secrets do not have to be passed on the command line. A single
+// trailing newline is trimmed from the contents of the file.
+// @@ escapes a literal @. See Config.ArgFiles for how the two interact.
+func FileOrStringVar(f *flag.FlagSet, p *string, name, value, usage string) {
+	*p = value
+	f.Var((*fileOrStringValue)(p), name, usage)
+}
+
+type fileOrStringValue string
+
+func (v *fileOrStringValue) Set(s string) error {
+	switch {
+	case strings.HasPrefix(s, "@@"):
+		s = s[1:]
+	case strings.HasPrefix(s, "@"):
+		b, err := ioutil.ReadFile(s[1:])
+		if err != nil {
+			return fmt.Errorf("failed to read value from file: %v", err)
+		}
+		s = strings.TrimSuffix(string(b), "\n")
+		s = strings.TrimSuffix(s, "\r")
+	}
+	*v = fileOrStringValue(s)
+	return nil
+}
+
+func (v *fileOrStringValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return string(*v)
+}
+
+func (v *fileOrStringValue) valueName() string {
+	return "string"
+}
+
+// StringSliceVar defines a string flag that can be repeated with each
+// value appended to p, e.g. -header a -header b sets p to [a b].
+// The default value is replaced by the first value on the command line.
+func StringSliceVar(f *flag.FlagSet, p *[]string, name string, value []string, usage string) {
+	*p = value
+	f.Var(&sliceValue{p: p}, name, usage+" (repeatable)")
+}
+
+// CSVSliceVar is like StringSliceVar but also splits each value on
+// commas, e.g. -header a,b -header c sets p to [a b c].
+func CSVSliceVar(f *flag.FlagSet, p *[]string, name string, value []string, usage string) {
+	*p = value
+	f.Var(&sliceValue{p: p, csv: true}, name, usage+" (comma separated, repeatable)")
+}
+
+type sliceValue struct {
+	p   *[]string
+	csv bool
+	set bool
+}
+
+func (s *sliceValue) Set(v string) error {
+	if !s.set {
+		*s.p = nil
+		s.set = true
+	}
+	if s.csv {
+		*s.p = append(*s.p, strings.Split(v, ",")...)
+	} else {
+		*s.p = append(*s.p, v)
+	}
+	return nil
+}
+
+func (s *sliceValue) String() string {
+	if s == nil || s.p == nil {
+		return ""
+	}
+	return strings.Join(*s.p, ",")
+}
+
+func (s *sliceValue) valueName() string {
+	return "string"
+}
+
+// DeprecatedFlagAlias defines the flag oldName in f as a deprecated alias
+// of the flag newName, e.g. after renaming a flag. Setting it sets newName
+// and prints a warning. It is left out of help and completions.
+// The flag newName must already be defined.
+//
+// It should be called from Flags after newName is defined.
+func DeprecatedFlagAlias(f *flag.FlagSet, oldName, newName string) {
+	fl, _ := lookupFlag(f, newName)
+	f.Var(&deprecatedValue{Value: fl.Value, oldName: oldName, newName: newName}, oldName, fl.Usage)
+	_, fi := lookupFlag(f, oldName)
+	fi.hidden = true
+}
+
+type deprecatedValue struct {
+	flag.Value
+	oldName string
+	newName string
+}
+
+func (v *deprecatedValue) String() string {
+	if v.Value == nil {
+		return ""
+	}
+	return v.Value.String()
+}
+
+func (v *deprecatedValue) IsBoolFlag() bool {
+	bf, ok := v.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && bf.IsBoolFlag()
+}
+
+// warnDeprecatedFlags prints a warning for each deprecated alias
+// that was set when parsing f.
+func (c *Config) warnDeprecatedFlags(f *flag.FlagSet) {
+	f.Visit(func(fl *flag.Flag) {
+		v := fl.Value
+		if iv, ok := v.(*infoValue); ok {
+			v = iv.Value
+		}
+		if v, ok := v.(*deprecatedValue); ok {
+			fmt.Fprintf(c.stderr(), c.tr("warning: flag -%v is deprecated, use -%v")+"\n", v.oldName, v.newName)
+		}
+	})
+}
+
+// isHiddenFlag reports whether fl is left out of help and completions.
+func isHiddenFlag(fl *flag.Flag) bool {
+	return getFlagInfo(fl).hidden
+}
+
+// StringVarP defines a string flag with both a long and a short name,
+// e.g. -output and -o, that set the same variable p.
+// Help lists them together as "-o, --output".
+// Setting both to different values on the command line is an error.
+func StringVarP(f *flag.FlagSet, p *string, name, short, value, usage string) {
+	tmp := flag.NewFlagSet("", flag.ContinueOnError)
+	tmp.StringVar(p, name, value, usage)
+	pairVar(f, tmp.Lookup(name), short)
+}
+
+// IntVarP is like StringVarP but for an int flag.
+func IntVarP(f *flag.FlagSet, p *int, name, short string, value int, usage string) {
+	tmp := flag.NewFlagSet("", flag.ContinueOnError)
+	tmp.IntVar(p, name, value, usage)
+	pairVar(f, tmp.Lookup(name), short)
+}
+
+// BoolVarP is like StringVarP but for a bool flag.
+func BoolVarP(f *flag.FlagSet, p *bool, name, short string, value bool, usage string) {
+	tmp := flag.NewFlagSet("", flag.ContinueOnError)
+	tmp.BoolVar(p, name, value, usage)
+	pairVar(f, tmp.Lookup(name), short)
+}
+
+// pairVar registers fl on f under its name and short.
+func pairVar(f *flag.FlagSet, fl *flag.Flag, short string) {
+	f.Var(&pairValue{Value: fl.Value}, fl.Name, fl.Usage)
+	f.Var(&pairValue{Value: fl.Value}, short, fl.Usage)
+
+	_, fi := lookupFlag(f, fl.Name)
+	fi.short = short
+	_, fi = lookupFlag(f, short)
+	fi.shortFor = fl.Name
+}
+
+// pairValue is the value of either name of a flag defined with
+// StringVarP and friends. It records what it was set to so that
+// conflicting values can be detected.
+type pairValue struct {
+	flag.Value
+	set  bool
+	last string
+}
+
+func (v *pairValue) Set(s string) error {
+	v.set = true
+	v.last = s
+	return v.Value.Set(s)
+}
+
+func (v *pairValue) String() string {
+	if v.Value == nil {
+		return ""
+	}
+	return v.Value.String()
+}
+
+func (v *pairValue) IsBoolFlag() bool {
+	bf, ok := v.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && bf.IsBoolFlag()
+}
+
+// checkFlagPairs returns an error if both names of a flag defined
+// with StringVarP and friends were set to different values.
+func checkFlagPairs(f *flag.FlagSet) error {
+	var err error
+	f.Visit(func(fl *flag.Flag) {
+		short := getFlagInfo(fl).short
+		if err != nil || short == "" {
+			return
+		}
+		sfl := f.Lookup(short)
+		lv, sv := pairValueOf(fl), pairValueOf(sfl)
+		if lv.set && sv.set && lv.last != sv.last {
+			err = fmt.Errorf("conflicting values %q and %q for flags -%v and -%v", sv.last, lv.last, short, fl.Name)
+		}
+	})
+	return err
+}
+
+// unwrapFlag returns fl with the values wrapped by the package replaced
+// with the underlying value so that its type can be inspected.
+// The value of a deprecated alias is the wrapped value of the flag it
+// aliases so the wrappers are unwrapped until none is left.
+func unwrapFlag(fl *flag.Flag) *flag.Flag {
+	ufl := *fl
+	for {
+		switch v := ufl.Value.(type) {
+		case *infoValue:
+			ufl.Value = v.Value
+		case *deprecatedValue:
+			ufl.Value = v.Value
+		case *pairValue:
+			ufl.Value = v.Value
+		default:
+			return &ufl
+		}
+	}
+}
+
+// pairValueOf returns the pairValue of fl, a flag
+// defined with StringVarP and friends.
+func pairValueOf(fl *flag.Flag) *pairValue {
+	v := fl.Value
+	if iv, ok := v.(*infoValue); ok {
+		v = iv.Value
+	}
+	return v.(*pairValue)
+}
+
+// unquoteUsage is like flag.UnquoteUsage but also knows the names
+// of the values of the flags defined by the package.
+func unquoteUsage(fl *flag.Flag) (name, usage string) {
+	fl = unwrapFlag(fl)
+	name, usage = flag.UnquoteUsage(fl)
+	if v, ok := fl.Value.(interface {
+		valueName() string
+	}); ok && name == "value" {
+		name = v.valueName()
+	}
+	return name, usage
+}
+
+// isZeroValue reports whether the default value of fl is
+// the zero value of its type like flag.PrintDefaults does.
+func isZeroValue(fl *flag.Flag) bool {
+	fl = unwrapFlag(fl)
+
+	typ := reflect.TypeOf(fl.Value)
+	var z reflect.Value
+	if typ.Kind() == reflect.Ptr {
+		z = reflect.New(typ.Elem())
+	} else {
+		z = reflect.Zero(typ)
+	}
+	v, ok := z.Interface().(flag.Value)
+	if !ok {
+		return fl.DefValue == ""
+	}
+	return fl.DefValue == v.String()
+}
+
+// FlagGroup lists the flags in f named names under the heading group
+// in help instead of under Flags, e.g. "Connection Flags". The flags
+// must already be defined.
+//
+// It should be called from Flags after the flags are defined.
+func FlagGroup(f *flag.FlagSet, group string, names ...string) {
+	for _, name := range names {
+		_, fi := lookupFlag(f, name)
+		fi.group = group
+	}
+}
+
+// flagGroups returns the sorted names of the groups of the flags in f.
+func flagGroups(f *flag.FlagSet) []string {
+	seen := make(map[string]bool)
+	var groups []string
+	f.VisitAll(func(fl *flag.Flag) {
+		fi := getFlagInfo(fl)
+		if fi.group != "" && !fi.hidden && !seen[fi.group] {
+			seen[fi.group] = true
+			groups = append(groups, fi.group)
+		}
+	})
+	sort.Strings(groups)
+	return groups
+}
+
+// printFlags writes the flags of f in group to w in the format of
+// flag.PrintDefaults. The short and long names of flags defined
+// with StringVarP and friends are printed together.
+func printFlags(w io.Writer, f *flag.FlagSet, group string) {
+	var b bytes.Buffer
+	f.VisitAll(func(fl *flag.Flag) {
+		fi := getFlagInfo(fl)
+		if fi.shortFor != "" || fi.hidden || fi.group != group {
+			return
+		}
+
+		if fi.short != "" {
+			fmt.Fprintf(&b, "  -%v, --%v", fi.short, fl.Name)
+		} else {
+			fmt.Fprintf(&b, "  -%v", fl.Name)
+		}
+
+		name, usage := unquoteUsage(fl)
+		if name != "" {
+			fmt.Fprintf(&b, " %v", name)
+		}
+
+		// Boolean flags of one ASCII letter are so common we
+		// treat them specially, putting their usage on the same line.
+		if b.Len() <= 4 {
+			b.WriteString("\t")
+		} else {
+			b.WriteString("\n    \t")
+		}
+		b.WriteString(strings.Replace(usage, "\n", "\n    \t", -1))
+
+		if !isZeroValue(fl) {
+			if name == "string" {
+				fmt.Fprintf(&b, " (default %q)", fl.DefValue)
+			} else {
+				fmt.Fprintf(&b, " (default %v)", fl.DefValue)
+			}
+		}
+		b.WriteString("\n")
+
+		w.Write(b.Bytes())
+		b.Reset()
+	})
+}
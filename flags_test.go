@@ -0,0 +1,537 @@
+package cli
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvVar(t *testing.T) {
+	const env = "CLI_TEST_TOKEN"
+
+	var token string
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.StringVar(&token, "token", "default", "API token.")
+			EnvVar(f, "token", env)
+		},
+	}
+
+	testCases := []struct {
+		name string
+		env  string
+		args []string
+		exp  string
+	}{
+		{name: "default", exp: "default"},
+		{name: "env", env: "fromenv", exp: "fromenv"},
+		{name: "flag", env: "fromenv", args: []string{"-token", "fromflag"}, exp: "fromflag"},
+	}
+
+	for _, tc := range testCases {
+		os.Unsetenv(env)
+		if tc.env != "" {
+			os.Setenv(env, tc.env)
+		}
+
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != 0 {
+			t.Fatalf("%v: unexpected status %v: %q", tc.name, status, stderr)
+		}
+		if token != tc.exp {
+			t.Errorf("%v: unexpected token %q; expected %q", tc.name, token, tc.exp)
+		}
+	}
+	os.Unsetenv(env)
+
+	_, _, stderr := runTest(t, root, "-h")
+	if !strings.Contains(stderr, "API token. (env: CLI_TEST_TOKEN)") {
+		t.Fatalf("help does not mention env: %q", stderr)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	const env = "CLI_TEST_NAME"
+
+	f, err := ioutil.TempFile("", "cli")
+	if err != nil {
+		t.Fatalf("failed to create config file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# Test config.\nname = fromconfig\n\nlong = true\n")
+	f.Close()
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	var name string
+	var long bool
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.String("config", "", "Config file.")
+			ConfigFile(f, "config")
+			f.StringVar(&name, "name", "default", "Name.")
+			EnvVar(f, "name", env)
+			f.BoolVar(&long, "long", false, "Use long format.")
+		},
+	}
+
+	testCases := []struct {
+		name string
+		env  string
+		args []string
+		exp  string
+	}{
+		{name: "noConfig", exp: "default"},
+		{name: "config", args: []string{"-config", f.Name()}, exp: "fromconfig"},
+		{name: "env", env: "fromenv", args: []string{"-config", f.Name()}, exp: "fromenv"},
+		{name: "flag", env: "fromenv", args: []string{"-config", f.Name(), "-name", "fromflag"}, exp: "fromflag"},
+	}
+
+	for _, tc := range testCases {
+		os.Unsetenv(env)
+		if tc.env != "" {
+			os.Setenv(env, tc.env)
+		}
+
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != 0 {
+			t.Fatalf("%v: unexpected status %v: %q", tc.name, status, stderr)
+		}
+		if name != tc.exp {
+			t.Errorf("%v: unexpected name %q; expected %q", tc.name, name, tc.exp)
+		}
+	}
+	os.Unsetenv(env)
+
+	if !long {
+		t.Errorf("flag from config file not set")
+	}
+
+	status, _, stderr := runTest(t, root, "-config", f.Name()+".missing")
+	if status != 2 || !strings.HasPrefix(stderr, "root: failed to read config file: ") {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+}
+
+func TestCountVar(t *testing.T) {
+	var verbosity int
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			CountVar(f, &verbosity, "v", "Increase verbosity.")
+		},
+	}
+
+	testCases := []struct {
+		args []string
+		exp  int
+	}{
+		{exp: 0},
+		{args: []string{"-v"}, exp: 1},
+		{args: []string{"-v", "-v", "-v"}, exp: 3},
+		{args: []string{"-v", "-v=false"}, exp: 0},
+	}
+
+	for _, tc := range testCases {
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != 0 {
+			t.Fatalf("%q: unexpected status %v: %q", tc.args, status, stderr)
+		}
+		if verbosity != tc.exp {
+			t.Errorf("%q: unexpected verbosity %v; expected %v", tc.args, verbosity, tc.exp)
+		}
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	if !strings.Contains(stderr, "  -v\tIncrease verbosity.") {
+		t.Fatalf("count flag not displayed like a bool flag: %q", stderr)
+	}
+}
+
+func TestVarP(t *testing.T) {
+	var (
+		output  string
+		n       int
+		verbose bool
+	)
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			StringVarP(f, &output, "output", "o", "out.txt", "Output file.")
+			IntVarP(f, &n, "count", "n", 1, "Number of runs.")
+			BoolVarP(f, &verbose, "verbose", "v", false, "Verbose output.")
+		},
+	}
+
+	testCases := []struct {
+		args    []string
+		output  string
+		n       int
+		verbose bool
+	}{
+		{output: "out.txt", n: 1},
+		{args: []string{"-o", "a", "-n", "3", "-v"}, output: "a", n: 3, verbose: true},
+		{args: []string{"--output", "b", "--count=4", "--verbose"}, output: "b", n: 4, verbose: true},
+		{args: []string{"-o", "c", "--output", "c"}, output: "c", n: 1},
+	}
+
+	for _, tc := range testCases {
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != 0 {
+			t.Fatalf("%q: unexpected status %v: %q", tc.args, status, stderr)
+		}
+		if output != tc.output || n != tc.n || verbose != tc.verbose {
+			t.Errorf("%q: unexpected values %q, %v, %v", tc.args, output, n, verbose)
+		}
+	}
+
+	status, _, stderr := runTest(t, root, "-o", "a", "-output", "b")
+	if status != 2 || !strings.HasPrefix(stderr, `root: conflicting values "a" and "b" for flags -o and -output`) {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	_, _, stderr = runTest(t, root, "-h")
+	for _, exp := range []string{
+		"  -o, --output string\n    \tOutput file. (default \"out.txt\")",
+		"  -n, --count int\n    \tNumber of runs. (default 1)",
+		"  -v, --verbose\n    \tVerbose output.",
+	} {
+		if !strings.Contains(stderr, exp) {
+			t.Errorf("expected %q in help: %q", exp, stderr)
+		}
+	}
+	if strings.Contains(stderr, "  -o string") {
+		t.Errorf("short flag listed separately: %q", stderr)
+	}
+}
+
+func TestExclusiveFlags(t *testing.T) {
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.Bool("json", false, "Output JSON.")
+			f.Bool("yaml", false, "Output YAML.")
+			f.Bool("v", false, "Verbose output.")
+			ExclusiveFlags(f, "json", "yaml")
+		},
+	}
+
+	testCases := []struct {
+		args   []string
+		status int
+		stderr string
+	}{
+		{},
+		{args: []string{"-json", "-v"}},
+		{args: []string{"-yaml"}},
+		{args: []string{"-yaml", "-json"}, status: 2, stderr: "root: flags -json and -yaml are mutually exclusive\n\nUsage:"},
+	}
+
+	for _, tc := range testCases {
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != tc.status || !strings.HasPrefix(stderr, tc.stderr) {
+			t.Errorf("%q: unexpected status %v and stderr %q", tc.args, status, stderr)
+		}
+	}
+}
+
+func TestEnumVar(t *testing.T) {
+	var format string
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			EnumVar(f, &format, "format", []string{"json", "yaml", "text"}, "text", "Output format.")
+		},
+	}
+
+	testCases := []struct {
+		args   []string
+		status int
+		exp    string
+		stderr string
+	}{
+		{exp: "text"},
+		{args: []string{"-format", "json"}, exp: "json"},
+		{args: []string{"-format=xml"}, status: 2, exp: "text", stderr: `root: invalid value "xml" for flag -format: must be one of json, yaml, text`},
+	}
+
+	for _, tc := range testCases {
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != tc.status || !strings.HasPrefix(stderr, tc.stderr) {
+			t.Errorf("%q: unexpected status %v and stderr %q", tc.args, status, stderr)
+		}
+		if format != tc.exp {
+			t.Errorf("%q: unexpected format %q; expected %q", tc.args, format, tc.exp)
+		}
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	exp := "  -format value\n    \tOutput format. (one of: json, yaml, text) (default text)"
+	if !strings.Contains(stderr, exp) {
+		t.Errorf("expected %q in help: %q", exp, stderr)
+	}
+}
+
+func TestDurationVar(t *testing.T) {
+	var timeout time.Duration
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			DurationVar(f, &timeout, "timeout", time.Second*10, "Timeout.")
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "-timeout", "1m30s")
+	if status != 0 || timeout != time.Second*90 {
+		t.Fatalf("unexpected status %v and timeout %v: %q", status, timeout, stderr)
+	}
+
+	status, _, stderr = runTest(t, root, "-timeout", "10x")
+	if status != 2 || !strings.HasPrefix(stderr, `root: invalid value "10x" for flag -timeout: must be a duration like 1h30m; valid units are ns, us, ms, s, m, h`) {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	_, _, stderr = runTest(t, root, "-h")
+	if !strings.Contains(stderr, "  -timeout duration\n    \tTimeout. (default 10s)") {
+		t.Fatalf("unexpected help %q", stderr)
+	}
+}
+
+func TestTimeVar(t *testing.T) {
+	var since, day time.Time
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			TimeVar(f, &since, "since", "", time.Time{}, "Show entries since.")
+			TimeVar(f, &day, "day", "2006-01-02", time.Time{}, "Day to show.")
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "-since", "2020-01-02T03:04:05Z", "-day", "2020-05-06")
+	if status != 0 {
+		t.Fatalf("unexpected status %v: %q", status, stderr)
+	}
+	if !since.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) || !day.Equal(time.Date(2020, 5, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected times %v and %v", since, day)
+	}
+
+	status, _, stderr = runTest(t, root, "-day", "yesterday")
+	if status != 2 || !strings.HasPrefix(stderr, `root: invalid value "yesterday" for flag -day: must be a time in the format 2006-01-02`) {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	_, _, stderr = runTest(t, root, "-h")
+	if !strings.Contains(stderr, "  -since time\n    \tShow entries since. (format: 2006-01-02T15:04:05Z07:00)\n") {
+		t.Fatalf("unexpected help %q", stderr)
+	}
+}
+
+func TestFileOrStringVar(t *testing.T) {
+	f, err := ioutil.TempFile("", "cli")
+	if err != nil {
+		t.Fatalf("failed to create token file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("secret\n")
+	f.Close()
+	if err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	var token string
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			FileOrStringVar(f, &token, "token", "default", "API token.")
+		},
+	}
+
+	testCases := []struct {
+		args   []string
+		status int
+		exp    string
+		stderr string
+	}{
+		{exp: "default"},
+		{args: []string{"-token", "plain"}, exp: "plain"},
+		{args: []string{"-token", "@" + f.Name()}, exp: "secret"},
+		{args: []string{"-token", "@@literal"}, exp: "@literal"},
+		{args: []string{"-token", "@" + f.Name() + ".missing"}, status: 2, exp: "default", stderr: `root: invalid value "@` + f.Name() + `.missing" for flag -token: failed to read value from file: `},
+	}
+
+	for _, tc := range testCases {
+		token = ""
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != tc.status || !strings.HasPrefix(stderr, tc.stderr) {
+			t.Errorf("%q: unexpected status %v and stderr %q", tc.args, status, stderr)
+		}
+		if token != tc.exp {
+			t.Errorf("%q: unexpected token %q", tc.args, token)
+		}
+	}
+}
+
+func TestSecretVar(t *testing.T) {
+	const env = "CLI_TEST_PIN"
+
+	var token string
+	var pin int
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			SecretVar(f, &token, "token", "hunter2", "API token.")
+			SecretIntVar(f, &pin, "pin", 1234, "PIN.")
+			EnvVar(f, "pin", env)
+			DeprecatedFlagAlias(f, "oldpin", "pin")
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "-h")
+	if status != 0 || strings.Contains(stderr, "hunter2") || strings.Contains(stderr, "1234") ||
+		!strings.Contains(stderr, "\n  -token secret\n    \tAPI token.\n") {
+		t.Fatalf("unexpected status %v and help %q", status, stderr)
+	}
+
+	d := Describe(root)
+	for _, fd := range d.Flags {
+		if (fd.Name == "token" || fd.Name == "pin") && fd.Default != "****" {
+			t.Errorf("default of -%v not redacted: %q", fd.Name, fd.Default)
+		}
+	}
+
+	status, _, _ = runTest(t, root, "-token", "s3cret", "-pin", "42")
+	if status != 0 || token != "s3cret" || pin != 42 {
+		t.Fatalf("unexpected status %v, token %q and pin %v", status, token, pin)
+	}
+
+	status, _, stderr = runTest(t, root, "-pin", "hunter2")
+	if status != 2 || strings.Contains(stderr, "hunter2") || !strings.HasPrefix(stderr, `root: invalid value "****" for flag -pin: must be an integer`) {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	status, _, stderr = runTest(t, root, "-oldpin", "12x4")
+	if status != 2 || strings.Contains(stderr, "12x4") || !strings.HasPrefix(stderr, `root: invalid value "****" for flag -oldpin: must be an integer`) {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	os.Setenv(env, "12x4")
+	defer os.Unsetenv(env)
+	status, _, stderr = runTest(t, root)
+	if status != 2 || !strings.HasPrefix(stderr, `root: invalid value "****" for flag -pin from $CLI_TEST_PIN: must be an integer`) {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+}
+
+func TestStringSliceVar(t *testing.T) {
+	var headers, tags, defTags []string
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			StringSliceVar(f, &headers, "header", nil, "Header to send.")
+			CSVSliceVar(f, &tags, "tag", defTags, "Tags to add.")
+		},
+	}
+
+	testCases := []struct {
+		args    []string
+		defTags []string
+		headers []string
+		tags    []string
+	}{
+		{},
+		{args: []string{"-header", "a: 1", "-header", "b: 2,3"}, headers: []string{"a: 1", "b: 2,3"}},
+		{args: []string{"-tag", "a,b", "-tag", "c"}, tags: []string{"a", "b", "c"}},
+		{defTags: []string{"x"}, tags: []string{"x"}},
+		{args: []string{"-tag", "y"}, defTags: []string{"x"}, tags: []string{"y"}},
+	}
+
+	for _, tc := range testCases {
+		defTags = tc.defTags
+		status, _, stderr := runTest(t, root, tc.args...)
+		if status != 0 {
+			t.Fatalf("%q: unexpected status %v: %q", tc.args, status, stderr)
+		}
+		if !reflect.DeepEqual(headers, tc.headers) || !reflect.DeepEqual(tags, tc.tags) {
+			t.Errorf("%q: unexpected headers %q and tags %q", tc.args, headers, tags)
+		}
+	}
+
+	defTags = []string{"x", "y"}
+	_, _, stderr := runTest(t, root, "-h")
+	for _, exp := range []string{
+		"  -header string\n    \tHeader to send. (repeatable)\n",
+		"  -tag string\n    \tTags to add. (comma separated, repeatable) (default \"x,y\")\n",
+	} {
+		if !strings.Contains(stderr, exp) {
+			t.Errorf("expected %q in help: %q", exp, stderr)
+		}
+	}
+}
+
+func TestDeprecatedFlagAlias(t *testing.T) {
+	var output string
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.StringVar(&output, "output", "", "Output file.")
+			DeprecatedFlagAlias(f, "out", "output")
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "-out", "a.txt")
+	if status != 0 || output != "a.txt" {
+		t.Fatalf("unexpected status %v and output %q: %q", status, output, stderr)
+	}
+	if stderr != "warning: flag -out is deprecated, use -output\n" {
+		t.Fatalf("unexpected stderr %q", stderr)
+	}
+
+	_, _, stderr = runTest(t, root, "-h")
+	if strings.Contains(stderr, "-out ") || !strings.Contains(stderr, "-output string") {
+		t.Fatalf("unexpected help %q", stderr)
+	}
+}
+
+func TestFlagGroup(t *testing.T) {
+	root := &testLeaf{
+		name: "root",
+		flags: func(f *flag.FlagSet) {
+			f.String("host", "", "Host to connect to.")
+			f.Int("port", 0, "Port to connect to.")
+			f.Bool("json", false, "Output JSON.")
+			f.Bool("v", false, "Verbose output.")
+			FlagGroup(f, "Connection Flags", "host", "port")
+			FlagGroup(f, "Output Flags", "json")
+		},
+	}
+
+	_, _, stderr := runTest(t, root, "-h")
+	exp := `
+Flags:
+  -help
+    	Print help and exit. Use -help=json for a JSON description.
+  -v	Verbose output.
+  -version
+    	Print version and exit.
+
+Connection Flags:
+  -host string
+    	Host to connect to.
+  -port int
+    	Port to connect to.
+
+Output Flags:
+  -json
+    	Output JSON.
+`
+	if !strings.HasSuffix(stderr, exp) {
+		t.Fatalf("unexpected help %q; expected suffix %q", stderr, exp)
+	}
+}
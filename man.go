@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// ManPages writes a roff formatted man page for cmd and each of its
+// descendants into dir. The pages are named after the full name of
+// each command with spaces replaced by dashes, e.g. examplecli-ls.1.
+// The sections mirror the help output.
+func ManPages(dir string, cmd Command) error {
+	return NewConfig().ManPages(dir, cmd)
+}
+
+// ManPages is like the package level ManPages
+// but with the settings in c.
+func (c *Config) ManPages(dir string, cmd Command) error {
+	var err error
+	c.walk(cmd, func(fullname string, cmd Command, f *flag.FlagSet) {
+		if err != nil {
+			return
+		}
+
+		name := strings.Replace(fullname, " ", "-", -1)
+		path := filepath.Join(dir, name+".1")
+		err = ioutil.WriteFile(path, c.manPage(fullname, cmd, f), 0644)
+		if err != nil {
+			err = fmt.Errorf("failed to write man page for %q: %v", fullname, err)
+		}
+	})
+	return err
+}
+
+func (c *Config) manPage(fullname string, cmd Command, f *flag.FlagSet) []byte {
+	var b bytes.Buffer
+
+	name := strings.Replace(fullname, " ", "-", -1)
+	fmt.Fprintf(&b, ".TH %v 1 \"\" %v\n", roffQuote(strings.ToUpper(name)), roffQuote(c.version()))
+
+	fmt.Fprintf(&b, ".SH NAME\n")
+	if cmd.Desc() != "" {
+		fmt.Fprintf(&b, "%v \\- %v\n", roffEscape(name), roffEscape(summary(cmd)))
+	} else {
+		fmt.Fprintf(&b, "%v\n", roffEscape(name))
+	}
+
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %v\n", roffEscape(fullname))
+	if u := usage(cmd, f); u != "" {
+		fmt.Fprintf(&b, "%v\n", roffEscape(u))
+	}
+
+	if cmd.Desc() != "" {
+		fmt.Fprintf(&b, ".SH DESCRIPTION\n")
+		for _, line := range strings.Split(cmd.Desc(), "\n") {
+			if line == "" {
+				fmt.Fprintf(&b, ".PP\n")
+				continue
+			}
+			fmt.Fprintf(&b, "%v\n.br\n", roffEscape(line))
+		}
+	}
+
+	if countFlags(f) > 0 {
+		fmt.Fprintf(&b, ".SH OPTIONS\n")
+		f.VisitAll(func(fl *flag.Flag) {
+			if isHiddenFlag(fl) {
+				return
+			}
+			fmt.Fprintf(&b, ".TP\n")
+			valueName, usage := unquoteUsage(fl)
+			if valueName != "" {
+				fmt.Fprintf(&b, ".BI %v \" %v\"\n", roffEscape("-"+fl.Name), roffEscape(valueName))
+			} else {
+				fmt.Fprintf(&b, ".B %v\n", roffEscape("-"+fl.Name))
+			}
+			if !isZeroValue(fl) {
+				usage += fmt.Sprintf(" (default %v)", fl.DefValue)
+			}
+			fmt.Fprintf(&b, "%v\n", roffEscape(usage))
+		})
+	}
+
+	return b.Bytes()
+}
+
+// roffEscape escapes s for use as text in a roff document.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// roffQuote escapes s for use as a quoted roff macro argument.
+func roffQuote(s string) string {
+	return `"` + strings.Replace(roffEscape(s), `"`, `\(dq`, -1) + `"`
+}
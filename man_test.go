@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ManPages(dir, testCompletionTree())
+	if err != nil {
+		t.Fatalf("failed to generate man pages: %v", err)
+	}
+
+	for _, name := range []string{"root.1", "root-ls.1", "root-remote.1", "root-remote-add.1"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("missing man page: %v", err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "root-ls.1"))
+	if err != nil {
+		t.Fatalf("failed to read man page: %v", err)
+	}
+	for _, want := range []string{".SH NAME\nroot\\-ls \\- Test leaf.", ".SH SYNOPSIS\n.B root ls\n", ".TP\n.B \\-l\nUse long format.\n"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("man page does not contain %q:\n%s", want, b)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// writeHelp writes the help b to w, through the pager if enabled.
+func (c *Config) writeHelp(w io.Writer, b []byte) {
+	if c.UsePager && page(w, b) {
+		return
+	}
+	w.Write(b)
+}
+
+// page shows b in the pager if w is a terminal that b does not
+// fit on. It reports whether it did.
+func page(w io.Writer, b []byte) bool {
+	f, ok := w.(*os.File)
+	if !ok || !isTerminal(f) {
+		return false
+	}
+	_, height, ok := terminalSize(f)
+	if !ok || bytes.Count(b, []byte("\n")) < height {
+		return false
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+	// PAGER may include arguments, e.g. "less -R".
+	args := strings.Fields(pager)
+	if len(args) == 0 {
+		return false
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = f
+	cmd.Stderr = f
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		// Pass through colors and quit if help fits after all like git does.
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	err := cmd.Start()
+	if err != nil {
+		return false
+	}
+	cmd.Wait()
+	return true
+}
@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPagerNotTerminal(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	c := &Config{UsePager: true}
+
+	_, _, stderr := runTestConfig(t, c, root, "-h")
+	if !strings.HasPrefix(stderr, "Usage:") {
+		t.Fatalf("help not written directly when Stderr is not a terminal: %q", stderr)
+	}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// REPL runs cmd interactively. It prompts on out and reads lines from in,
+// splitting each into arguments like a shell would, including single and
+// double quotes, and runs cmd with them as if they were passed on the
+// command line. Output goes to Config.Stdout and Config.Stderr as usual.
+//
+// The line help prints the help of cmd, help followed by subcommands
+// prints the help of the last one and exit stops the REPL.
+// It returns the status of the last line run once in reaches EOF or
+// exit is entered.
+func REPL(ctx context.Context, cmd Command, in io.Reader, out io.Writer) int {
+	return NewConfig().REPL(ctx, cmd, in, out)
+}
+
+// REPL is like the package level REPL but with the settings in c.
+func (c *Config) REPL(ctx context.Context, cmd Command, in io.Reader, out io.Writer) int {
+	var status int
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "%v> ", c.rootName(cmd))
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return status
+		}
+
+		args, err := splitWords(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(out, "%v\n", err)
+			status = StatusError
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit":
+			return status
+		case "help":
+			// RunStatus handles help topics and help search itself.
+			_, topic := c.Topics[args[len(args)-1]]
+			if len(args) == 2 && topic || c.HelpSearch && len(args) == 3 && args[1] == "search" {
+				break
+			}
+			args = append(args[1:], "-help")
+		}
+		status = c.RunStatus(ctx, cmd, args)
+	}
+}
+
+// splitWords splits line into words like a shell. Single quotes preserve
+// everything within them, double quotes allow escaping " and \ with \
+// and a \ outside quotes escapes the next character.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+				i++
+				word.WriteRune(runes[i])
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			}
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	testCases := []struct {
+		line string
+		exp  []string
+		err  string
+	}{
+		{line: "", exp: nil},
+		{line: "  ls  -l\t/tmp ", exp: []string{"ls", "-l", "/tmp"}},
+		{line: `echo 'a b' "c \"d\" \\ e" f\ g ''`, exp: []string{"echo", "a b", `c "d" \ e`, "f g", ""}},
+		{line: `echo 'a\b'`, exp: []string{"echo", `a\b`}},
+		{line: `echo "a`, err: `unterminated " quote`},
+	}
+
+	for _, tc := range testCases {
+		words, err := splitWords(tc.line)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: unexpected error %v", tc.line, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(words, tc.exp) {
+			t.Errorf("%q: unexpected words %q and error %v", tc.line, words, err)
+		}
+	}
+}
+
+func TestREPL(t *testing.T) {
+	var calls []string
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "echo",
+				run: func(ctx context.Context, args []string) int {
+					calls = append(calls, strings.Join(args, "|"))
+					return len(args)
+				},
+			},
+		},
+	}
+
+	var errb bytes.Buffer
+	c := &Config{Stderr: &errb}
+
+	in := strings.NewReader("echo a 'b c'\n\nhelp\necho x\nexit\necho never\n")
+	var out bytes.Buffer
+	status := c.REPL(context.Background(), root, in, &out)
+	if status != 1 {
+		t.Fatalf("unexpected status %v", status)
+	}
+	if exp := []string{"a|b c", "x"}; !reflect.DeepEqual(calls, exp) {
+		t.Fatalf("unexpected calls %q; expected %q", calls, exp)
+	}
+	if out.String() != strings.Repeat("root> ", 5) {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if !strings.HasPrefix(errb.String(), "Usage:\n\troot") {
+		t.Fatalf("help not printed: %q", errb.String())
+	}
+
+	errb.Reset()
+	status = c.REPL(context.Background(), root, strings.NewReader("help echo\n"), &out)
+	if status != 0 || !strings.HasPrefix(errb.String(), "Usage:\n\troot echo") {
+		t.Fatalf("unexpected status %v and help %q", status, errb.String())
+	}
+
+	c.Topics = map[string]string{"env": "Environment variables."}
+	errb.Reset()
+	c.REPL(context.Background(), root, strings.NewReader("help env\n"), &out)
+	if errb.String() != "Environment variables.\n" {
+		t.Fatalf("topic not printed: %q", errb.String())
+	}
+}
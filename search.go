@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// SearchResult is a command matched by Search.
+type SearchResult struct {
+	// FullName is the full name of the command, e.g. "examplecli ls".
+	FullName string
+	// Snippet is the line of the command's description that matched
+	// or its first line if its name matched.
+	Snippet string
+}
+
+// Search returns the commands in the tree rooted at cmd whose names,
+// aliases or descriptions contain term, ignoring case. Hidden commands
+// are left out.
+func Search(cmd Command, term string) []SearchResult {
+	return NewConfig().Search(cmd, term)
+}
+
+// Search is like the package level Search but with the settings in c.
+func (c *Config) Search(cmd Command, term string) []SearchResult {
+	term = strings.ToLower(term)
+	var results []SearchResult
+	c.walk(cmd, func(fullname string, cmd Command, f *flag.FlagSet) {
+		for _, name := range names(cmd) {
+			if strings.Contains(strings.ToLower(name), term) {
+				results = append(results, SearchResult{FullName: fullname, Snippet: summary(cmd)})
+				return
+			}
+		}
+		for _, line := range strings.Split(cmd.Desc(), "\n") {
+			if strings.Contains(strings.ToLower(line), term) {
+				results = append(results, SearchResult{FullName: fullname, Snippet: strings.TrimSpace(line)})
+				return
+			}
+		}
+	})
+	return results
+}
+
+// helpSearch prints the results of searching cmd for term.
+func (c *Config) helpSearch(cmd Command, term string) int {
+	results := c.Search(cmd, term)
+	if len(results) == 0 {
+		fmt.Fprintf(c.stderr(), c.tr("no commands match %q")+"\n", term)
+		return StatusError
+	}
+
+	tw := c.newTabWriter(c.stdout(), c.helpWidth(c.stdout()))
+	for _, r := range results {
+		fmt.Fprintf(tw, "%v\t%v\n", r.FullName, r.Snippet)
+	}
+	err := tw.Flush()
+	if err != nil {
+		panicf("tabwriter flush error: %v", err)
+	}
+	return StatusOK
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testDescLeaf struct {
+	testLeaf
+	desc string
+}
+
+func (l *testDescLeaf) Desc() string {
+	return l.desc
+}
+
+func TestSearch(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testDescLeaf{testLeaf: testLeaf{name: "ls", aliases: []string{"list"}}, desc: "Lists a directory.\nCan also list Archives."},
+			&testDescLeaf{testLeaf: testLeaf{name: "cp"}, desc: "Copies files."},
+			&testBranch{name: "archive", subcmds: []Command{
+				&testDescLeaf{testLeaf: testLeaf{name: "create"}, desc: "Creates an archive."},
+			}},
+		},
+	}
+
+	testCases := []struct {
+		term string
+		exp  []SearchResult
+	}{
+		{term: "copies", exp: []SearchResult{{FullName: "root cp", Snippet: "Copies files."}}},
+		{term: "LIST", exp: []SearchResult{{FullName: "root ls", Snippet: "Lists a directory."}}},
+		{term: "archive", exp: []SearchResult{
+			{FullName: "root archive", Snippet: "Test branch."},
+			{FullName: "root archive create", Snippet: "Creates an archive."},
+			{FullName: "root ls", Snippet: "Can also list Archives."},
+		}},
+		{term: "nothing"},
+	}
+
+	for _, tc := range testCases {
+		results := Search(root, tc.term)
+		if !reflect.DeepEqual(results, tc.exp) {
+			t.Errorf("%q: unexpected results %+v; expected %+v", tc.term, results, tc.exp)
+		}
+	}
+
+	c := &Config{HelpSearch: true}
+
+	status, stdout, _ := runTestConfig(t, c, root, "help", "search", "copies")
+	if status != 0 || stdout != "root cp    Copies files.\n" {
+		t.Fatalf("unexpected status %v and stdout %q", status, stdout)
+	}
+	status, _, stderr := runTestConfig(t, c, root, "help", "search", "nothing")
+	if status != 1 || !strings.Contains(stderr, `no commands match "nothing"`) {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+}
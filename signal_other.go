@@ -0,0 +1,31 @@
+//go:build !plan9
+// +build !plan9
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// signalNumber returns the number of sig.
+// It reports false if sig has none.
+func signalNumber(sig os.Signal) (int, bool) {
+	s, ok := sig.(syscall.Signal)
+	return int(s), ok
+}
+
+// exitSignal returns the number of the signal that killed the child
+// process of eerr. It reports false if the child was not killed
+// by a signal.
+func exitSignal(eerr *exec.ExitError) (int, bool) {
+	ws, ok := eerr.Sys().(interface {
+		Signaled() bool
+		Signal() syscall.Signal
+	})
+	if !ok || !ws.Signaled() {
+		return 0, false
+	}
+	return int(ws.Signal()), true
+}
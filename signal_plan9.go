@@ -0,0 +1,21 @@
+//go:build plan9
+// +build plan9
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+)
+
+// signalNumber returns the number of sig.
+// Notes on Plan 9 have no numbers so it always reports false.
+func signalNumber(sig os.Signal) (int, bool) {
+	return 0, false
+}
+
+// exitSignal returns the number of the signal that killed the child
+// process of eerr. Plan 9 has no signals so it always reports false.
+func exitSignal(eerr *exec.ExitError) (int, bool) {
+	return 0, false
+}
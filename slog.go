@@ -0,0 +1,34 @@
+//go:build go1.21
+// +build go1.21
+
+package cli
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogLogger returns a structured logger with the full name of the
+// invoked command as the command attribute.
+// It is the logger passed to WithSlogLogger or, by default, a logger
+// writing text to Stderr(ctx) at Config.LogLevel.
+//
+// The passed context must be derived from the context
+// passed to Run.
+func SlogLogger(ctx context.Context) *slog.Logger {
+	l, ok := ctx.Value(slogLoggerKey{}).(*slog.Logger)
+	if !ok {
+		l = slog.New(slog.NewTextHandler(Stderr(ctx), &slog.HandlerOptions{
+			Level: slog.Level(config(ctx).LogLevel),
+		}))
+	}
+	return l.With("command", FullName(ctx))
+}
+
+// WithSlogLogger returns a context derived from ctx in which
+// SlogLogger returns l with the command attribute added.
+func WithSlogLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, slogLoggerKey{}, l)
+}
+
+type slogLoggerKey struct{}
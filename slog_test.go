@@ -0,0 +1,53 @@
+//go:build go1.21
+// +build go1.21
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{
+				name: "ls",
+				run: func(ctx context.Context, args []string) int {
+					SlogLogger(ctx).Debug("listing", "dir", args[0])
+					SlogLogger(ctx).Info("listed", "dir", args[0])
+					return 0
+				},
+			},
+		},
+	}
+
+	status, _, stderr := runTest(t, root, "ls", "/tmp")
+	if status != 0 || !strings.HasSuffix(stderr, ` level=INFO msg=listed command="root ls" dir=/tmp`+"\n") || strings.Contains(stderr, "listing") {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	c := &Config{LogLevel: int(slog.LevelDebug)}
+	_, _, stderr = runTestConfig(t, c, root, "ls", "/tmp")
+	if !strings.Contains(stderr, ` level=DEBUG msg=listing command="root ls" dir=/tmp`+"\n") {
+		t.Fatalf("debug record not logged: %q", stderr)
+	}
+
+	var b bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&b, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	status = RunStatus(WithSlogLogger(context.Background(), l), root, []string{"ls", "/tmp"})
+	if status != 0 || b.String() != `{"level":"INFO","msg":"listed","command":"root ls","dir":"/tmp"}`+"\n" {
+		t.Fatalf("unexpected status %v and log %q", status, b.String())
+	}
+}
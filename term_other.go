@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package cli
+
+import (
+	"os"
+)
+
+// terminalSize returns the width and height of the terminal f refers to.
+// It is not supported on this platform.
+func terminalSize(f *os.File) (width, height int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// helpTopic prints the content of a topic.
+func (c *Config) helpTopic(content string) int {
+	w := c.helpOutput()
+	c.writeHelp(w, []byte(wrap(strings.TrimRight(content, "\n"), c.helpWidth(w))+"\n"))
+	return StatusOK
+}
+
+// writeTopics writes the Topics section of the help of the root
+// command fullname to w.
+func (c *Config) writeTopics(w io.Writer, color colorizer, width int, fullname string) {
+	var names []string
+	for name := range c.Topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "\n%v\n", color.header(c.tr("Topics:")))
+	tw := c.newTabWriter(w, width)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %v\t%v\n", color.name(name), strings.Split(c.Topics[name], "\n")[0])
+	}
+	err := tw.Flush()
+	if err != nil {
+		panicf("tabwriter flush error: %v", err)
+	}
+	fmt.Fprintf(w, "\n"+c.tr("Run %q to read a topic.")+"\n", fullname+" help <topic>")
+}
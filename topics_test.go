@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTopics(t *testing.T) {
+	root := &testBranch{
+		name: "root",
+		subcmds: []Command{
+			&testLeaf{name: "ls"},
+		},
+	}
+
+	c := &Config{
+		Topics: map[string]string{
+			"config-format": "The format of the config file.\n\nEach line is a key = value pair.\n",
+			"env":           "Environment variables.",
+		},
+	}
+
+	_, _, stderr := runTestConfig(t, c, root, "-h")
+	exp := "\nTopics:\n  config-format    The format of the config file.\n  env              Environment variables.\n\nRun \"root help <topic>\" to read a topic.\n"
+	if !strings.HasSuffix(stderr, exp) {
+		t.Fatalf("topics not in help: %q", stderr)
+	}
+
+	_, _, stderr = runTestConfig(t, c, root, "ls", "-h")
+	if strings.Contains(stderr, "Topics:") {
+		t.Fatalf("topics in help of subcommand: %q", stderr)
+	}
+
+	status, _, stderr := runTestConfig(t, c, root, "help", "config-format")
+	if status != 0 || stderr != "The format of the config file.\n\nEach line is a key = value pair.\n" {
+		t.Fatalf("unexpected status %v and stderr %q", status, stderr)
+	}
+
+	status, _, _ = runTestConfig(t, c, root, "config-format")
+	if status != 2 {
+		t.Fatalf("topic dispatched as a command: %v", status)
+	}
+}